@@ -37,11 +37,32 @@ type DBConf struct {
 }
 
 type DstConf struct {
-	SteamKey  string `mapstructure:"steamKey"`
-	KleiToken string `mapstructure:"kleiToken"`
-	ProxyURL  string `mapstructure:"proxyURL"`
+	SteamKey  string    `mapstructure:"steamKey"`
+	KleiToken string    `mapstructure:"kleiToken"`
+	Proxy     ProxyConf `mapstructure:"proxy"`
 
-	Lobby LobbyConf `mapstructure:"lobby"`
+	Lobby     LobbyConf     `mapstructure:"lobby"`
+	Endpoints LobbyEndpoint `mapstructure:"endpoints"`
+}
+
+// ProxyConf is the proxy of outbound clients, supports http, https and socks5 scheme
+type ProxyConf struct {
+	// default proxy for all clients
+	URL string `mapstructure:"url"`
+	// overrides for specific client, "direct" means no proxy
+	Lobby string `mapstructure:"lobby"`
+	Steam string `mapstructure:"steam"`
+	// NO_PROXY style exclusions, e.g. localhost,10.0.0.0/8,.example.com
+	NoProxy string `mapstructure:"noProxy"`
+}
+
+// LobbyEndpoint overrides klei lobby urls, the default urls will be used if empty
+type LobbyEndpoint struct {
+	RegionURL string `mapstructure:"region"`
+	// template params: {{.region}} {{.platform}}
+	ServersURL string `mapstructure:"servers"`
+	// template params: {{.region}}
+	DetailsURL string `mapstructure:"details"`
 }
 
 type LobbyConf struct {
@@ -49,6 +70,34 @@ type LobbyConf struct {
 	ClearCron   string        `mapstructure:"clear"`
 	TTL         time.Duration `mapstructure:"ttl"`
 	Timeout     time.Duration `mapstructure:"timeout"`
+
+	Retry   LobbyRetryConf   `mapstructure:"retry"`
+	Limit   LobbyLimitConf   `mapstructure:"limit"`
+	Details LobbyDetailsConf `mapstructure:"details"`
+}
+
+// LobbyDetailsConf controls the crawler of server details
+type LobbyDetailsConf struct {
+	Enable bool   `mapstructure:"enable"`
+	Cron   string `mapstructure:"cron"`
+	// concurrent requests to klei
+	Concurrency int `mapstructure:"concurrency"`
+	// max servers crawled per run, 0 means all servers in the latest snapshot
+	Budget  int           `mapstructure:"budget"`
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// LobbyRetryConf controls how to retry the failed requests to klei, 0 count means no retry
+type LobbyRetryConf struct {
+	Count       int           `mapstructure:"count"`
+	WaitTime    time.Duration `mapstructure:"wait"`
+	MaxWaitTime time.Duration `mapstructure:"maxWait"`
+}
+
+// LobbyLimitConf limits the requests per second to each klei host, 0 rate means no limit
+type LobbyLimitConf struct {
+	Rate  float64 `mapstructure:"rate"`
+	Burst int     `mapstructure:"burst"`
 }
 
 // Load tries to load config file and unmarshal it to *AppConf
@@ -20,7 +20,9 @@ require (
 	github.com/spf13/viper v1.18.2
 	github.com/yuin/gopher-lua v1.1.1
 	go.mongodb.org/mongo-driver v1.11.6
+	golang.org/x/net v0.22.0
 	golang.org/x/sync v0.6.0
+	golang.org/x/time v0.5.0
 	gorm.io/driver/mysql v1.5.4
 	gorm.io/gorm v1.25.7
 )
@@ -87,7 +89,6 @@ require (
 	golang.org/x/arch v0.9.0 // indirect
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
-	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sys v0.24.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
@@ -18,16 +18,46 @@ type API struct {
 func NewRouter(ctx context.Context, hertz *server.Hertz, env *types.Env) (*API, error) {
 
 	hlog.Debug("initializing data repo and creating db index")
-	statisticRepo := repo.NewLobbyStatisticRepo(env.MongoDB)
 	// repositories
+	statisticRepo, err := repo.NewLobbyStatisticRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
 	lobbyRepo, err := repo.NewLobbyRepo(ctx, env.MongoDB)
 	if err != nil {
 		return nil, err
 	}
+	// one-time migration from the legacy lobby collection, it takes a while if there are many snapshots
+	if migrated, err := lobbyRepo.MigrateLegacySnapshots(ctx); err != nil {
+		return nil, err
+	} else if migrated > 0 {
+		hlog.Infof("migrated %d legacy lobby snapshots", migrated)
+	}
+	collectRepo, err := repo.NewLobbyCollectRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
+	detailsRepo, err := repo.NewLobbyDetailsRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
+	eventRepo, err := repo.NewLobbyEventRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
+	playerRepo, err := repo.NewPlayerRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
+	modRepo, err := repo.NewModRepo(ctx, env.MongoDB)
+	if err != nil {
+		return nil, err
+	}
 
 	// handler
-	lobbyMongoHandler := handler.NewLobbyMongoHandler(lobbyRepo, statisticRepo, env.LobbyCLI, env.GeoIpDB)
-	modHandler := handler.NewWorkShopHandler(env.SteamCLI)
+	lobbyMongoHandler := handler.NewLobbyMongoHandler(lobbyRepo, statisticRepo, collectRepo, detailsRepo, eventRepo, playerRepo, modRepo, env.LobbyCLI, env.GeoIpDB)
+	modHandler := handler.NewWorkShopHandler(env.SteamCLI, modRepo, lobbyRepo)
+	playerHandler := handler.NewPlayerMongoHandler(playerRepo)
 
 	// system api
 	sysAPI := SystemAPI{}
@@ -37,10 +67,23 @@ func NewRouter(ctx context.Context, hertz *server.Hertz, env *types.Env) (*API,
 	lobbyAPI := LobbyAPI{LobbyHandler: lobbyMongoHandler}
 	hertz.GET("/lobby/list", lobbyAPI.List)
 	hertz.GET("/lobby/details", lobbyAPI.Details)
+	hertz.POST("/lobby/details/batch", lobbyAPI.DetailsBatch)
 	hertz.GET("/lobby/stat", lobbyAPI.Statistic)
+	hertz.GET("/lobby/stat/characters", lobbyAPI.Characters)
+	hertz.GET("/lobby/collect", lobbyAPI.CollectReports)
+	hertz.GET("/lobby/history", lobbyAPI.History)
+	hertz.GET("/lobby/events", lobbyAPI.Events)
 
-	modAPI := ModAPI{modHandler: modHandler}
+	modAPI := ModAPI{modHandler: modHandler, lobbyHandler: lobbyMongoHandler}
 	hertz.GET("/mod/search", modAPI.Search)
+	hertz.GET("/mod/popular", modAPI.Popular)
+	hertz.GET("/mod/:id/usage", modAPI.Usage)
+	hertz.GET("/mod/:id/servers", modAPI.Servers)
+	hertz.GET("/mod/:id/related", modAPI.Related)
+
+	// player api
+	playerAPI := PlayerAPI{playerHandler: playerHandler}
+	hertz.GET("/player/search", playerAPI.Search)
 
 	// mod api
 
@@ -2,9 +2,13 @@ package api
 
 import (
 	"context"
+	"errors"
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/dstgo/tracker/internal/data/repo"
 	"github.com/dstgo/tracker/internal/handler"
 	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
 	"github.com/dstgo/tracker/pkg/resp"
 	"time"
 )
@@ -24,13 +28,13 @@ func (l *LobbyAPI) List(c context.Context, ctx *app.RequestContext) {
 
 	pageResult, err := l.LobbyHandler.GetServersByPage(c, listOptions)
 	if err != nil {
-		resp.Failed(ctx).Error(err).Do()
+		lobbyFailed(ctx, err).Do()
 	} else {
 		resp.Ok(ctx).Data(pageResult).Do()
 	}
 }
 
-// Details [GET] /lobby/details?rowId=KU_X19asjdla&region=ap-east-1
+// Details [GET] /lobby/details?rowId=KU_X19asjdla&region=ap-east-1 or /lobby/details?serverId=SV_xxx
 // returns details info for specific lobby server
 func (l *LobbyAPI) Details(c context.Context, ctx *app.RequestContext) {
 	var detailsOptions types.QueryLobbyServerDetailsOption
@@ -39,14 +43,79 @@ func (l *LobbyAPI) Details(c context.Context, ctx *app.RequestContext) {
 		return
 	}
 
-	details, err := l.LobbyHandler.GetServerDetails(c, detailsOptions.Region, detailsOptions.RowId)
+	details, err := l.LobbyHandler.GetServerDetails(c, detailsOptions)
 	if err != nil {
-		resp.Failed(ctx).Error(err).Do()
+		lobbyFailed(ctx, err).Do()
 	} else {
 		resp.Ok(ctx).Data(details).Do()
 	}
 }
 
+// DetailsBatch [POST] /lobby/details/batch {"servers":[{"rowId":"KU_X19asjdla","region":"ap-east-1"}]}
+// returns details info for many lobby servers, the failed items carry their own code and error
+func (l *LobbyAPI) DetailsBatch(c context.Context, ctx *app.RequestContext) {
+	var batchOptions types.QueryLobbyServerDetailsBatchOption
+	if err := ctx.BindAndValidate(&batchOptions); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	items, err := l.LobbyHandler.GetServerDetailsBatch(c, batchOptions.Servers)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	for i := range items {
+		if items[i].Err != nil {
+			items[i].Code = lobbyErrStatus(items[i].Err)
+			items[i].Error = items[i].Err.Error()
+		}
+	}
+
+	resp.Ok(ctx).Data(items).Do()
+}
+
+// History [GET] /lobby/history?rowId=KU_X19asjdla&from=xx&to=xx&step=10m, serverId is accepted instead of rowId
+// returns the downsampled time series of single server
+func (l *LobbyAPI) History(c context.Context, ctx *app.RequestContext) {
+	var opt types.QueryLobbyHistoryOption
+	if err := ctx.BindAndValidate(&opt); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	step, err := time.ParseDuration(opt.Step)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	history, err := l.LobbyHandler.GetServerHistory(c, opt.RowId, opt.ServerId, opt.From, opt.To, step)
+	if err != nil {
+		lobbyFailed(ctx, err).Do()
+	} else {
+		resp.Ok(ctx).Data(history).Do()
+	}
+}
+
+// Events [GET] /lobby/events?serverId=SV_xxx&region=ap-east-1&type=restarted,wiped&from=xx&to=xx
+// returns the lifecycle events of servers, the latest first
+func (l *LobbyAPI) Events(c context.Context, ctx *app.RequestContext) {
+	var opt types.QueryLobbyEventsOption
+	if err := ctx.BindAndValidate(&opt); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	events, err := l.LobbyHandler.GetEvents(c, opt)
+	if err != nil {
+		lobbyFailed(ctx, err).Do()
+	} else {
+		resp.Ok(ctx).Data(events).Do()
+	}
+}
+
 // Statistic [GET] /lobby/stat?before=xx&until=xx
 // returns statistics information for dst lobby
 func (l *LobbyAPI) Statistic(c context.Context, ctx *app.RequestContext) {
@@ -69,3 +138,81 @@ func (l *LobbyAPI) Statistic(c context.Context, ctx *app.RequestContext) {
 		resp.Ok(ctx).Data(statisticInfo).Do()
 	}
 }
+
+// Characters [GET] /lobby/stat/characters?region=ap-east-1&platform=1&game_mode=survival&from=xx&to=xx&step=1h
+// returns the time series of character distribution of online players
+func (l *LobbyAPI) Characters(c context.Context, ctx *app.RequestContext) {
+	var opt types.QueryLobbyCharacterOption
+	if err := ctx.BindAndValidate(&opt); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	step, err := time.ParseDuration(opt.Step)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	points, err := l.LobbyHandler.GetCharacterStatistic(c, opt, step)
+	if err != nil {
+		lobbyFailed(ctx, err).Do()
+	} else {
+		resp.Ok(ctx).Data(points).Do()
+	}
+}
+
+// CollectReports [GET] /lobby/collect?before=xx&until=xx&tail=xx
+// returns the latest collection reports, includes the outcome of each region-platform pair
+func (l *LobbyAPI) CollectReports(c context.Context, ctx *app.RequestContext) {
+	var opt types.QueryLobbyCollectOption
+	if err := ctx.BindAndValidate(&opt); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	reports, err := l.LobbyHandler.GetCollectReports(c, opt.Before, opt.Until, opt.Tail)
+	if err != nil {
+		lobbyFailed(ctx, err).Do()
+	} else {
+		resp.Ok(ctx).Data(reports).Do()
+	}
+}
+
+// lobbyFailed maps the errors returned by klei lobby and lobby repo into response with meaningful status code
+func lobbyFailed(ctx *app.RequestContext, err error) *resp.Response {
+	return resp.New(ctx).Status(lobbyErrStatus(err)).Error(err)
+}
+
+// lobbyErrStatus returns the http status code for the errors returned by klei lobby and lobby repo,
+// the unknown errors are considered internal
+func lobbyErrStatus(err error) int {
+	status := consts.StatusInternalServerError
+
+	switch {
+	// invalid options from client
+	case errors.Is(err, repo.ErrInvalidCursor), errors.Is(err, handler.ErrInvalidSort), errors.Is(err, handler.ErrInvalidModsMatch),
+		errors.Is(err, handler.ErrServerRequired), errors.Is(err, handler.ErrInvalidEventType), errors.Is(err, handler.ErrInvalidRange):
+		status = consts.StatusBadRequest
+	// checked first, the timeout could be wrapped by other errors such as DecodeError
+	case errors.Is(err, context.DeadlineExceeded):
+		status = consts.StatusGatewayTimeout
+	case errors.Is(err, lobbyapi.ErrRegionNotFound), errors.Is(err, lobbyapi.ErrServerNotFound):
+		status = consts.StatusNotFound
+	case errors.Is(err, lobbyapi.ErrRateLimited):
+		status = consts.StatusTooManyRequests
+	// token is configured by tracker, it is not the fault of client
+	case errors.Is(err, lobbyapi.ErrTokenRequired), errors.Is(err, lobbyapi.ErrTokenRejected):
+		status = consts.StatusServiceUnavailable
+	case errors.Is(err, lobbyapi.ErrServerDown), errors.Is(err, lobbyapi.ErrUnexpectedStatus):
+		status = consts.StatusBadGateway
+	// malformed payload from lobby
+	case errors.As(err, new(*lobbyapi.DecodeError)):
+		status = consts.StatusBadGateway
+	// the snapshot has been cleared, client should start over
+	case errors.Is(err, repo.ErrCursorExpired):
+		status = consts.StatusGone
+	}
+
+	return status
+}
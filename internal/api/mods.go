@@ -6,10 +6,12 @@ import (
 	"github.com/dstgo/tracker/internal/handler"
 	"github.com/dstgo/tracker/internal/types"
 	"github.com/dstgo/tracker/pkg/resp"
+	"time"
 )
 
 type ModAPI struct {
-	modHandler handler.ModHandler
+	modHandler   handler.ModHandler
+	lobbyHandler handler.LobbyHandler
 }
 
 // Search returns a list of dst workshop files
@@ -27,3 +29,83 @@ func (mod ModAPI) Search(c context.Context, ctx *app.RequestContext) {
 		resp.Ok(ctx).Data(list.Response).Do()
 	}
 }
+
+// Popular [GET] /mod/popular?sort=players&region=ap-east-1&platform=1
+// returns the most used workshop mods among the latest crawled servers
+func (mod ModAPI) Popular(c context.Context, ctx *app.RequestContext) {
+	var queryOption types.QueryPopularModsOption
+	if err := ctx.BindAndValidate(&queryOption); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	list, err := mod.modHandler.GetPopularMods(c, queryOption)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+	} else {
+		resp.Ok(ctx).Data(list).Do()
+	}
+}
+
+// Usage [GET] /mod/{id}/usage?from=xx&to=xx&step=1h&region=ap-east-1&platform=1
+// returns the time series of servers and online players that used the mod
+func (mod ModAPI) Usage(c context.Context, ctx *app.RequestContext) {
+	var queryOption types.QueryModUsageOption
+	if err := ctx.BindAndValidate(&queryOption); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	step, err := time.ParseDuration(queryOption.Step)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	usage, err := mod.modHandler.GetModUsage(c, queryOption, step)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+	} else {
+		resp.Ok(ctx).Data(usage).Do()
+	}
+}
+
+// Servers [GET] /mod/{id}/servers?sort=-online&page=1&size=10
+// returns the servers of the latest snapshot that enabled the mod, only the crawled servers are known
+func (mod ModAPI) Servers(c context.Context, ctx *app.RequestContext) {
+	var queryOption types.QueryModServersOption
+	if err := ctx.BindAndValidate(&queryOption); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	pageResult, err := mod.lobbyHandler.GetServersByPage(c, types.QueryLobbyServersOptions{
+		Page:   queryOption.Page,
+		Size:   queryOption.Size,
+		Cursor: queryOption.Cursor,
+		Sort:   queryOption.Sort,
+		Mods:   queryOption.Id,
+	})
+	if err != nil {
+		lobbyFailed(ctx, err).Do()
+	} else {
+		resp.Ok(ctx).Data(pageResult).Do()
+	}
+}
+
+// Related [GET] /mod/{id}/related?size=10&min_servers=2
+// returns the mods that servers using the mod also use, and the packs frequently combined with it
+func (mod ModAPI) Related(c context.Context, ctx *app.RequestContext) {
+	var queryOption types.QueryRelatedModsOption
+	if err := ctx.BindAndValidate(&queryOption); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	related, err := mod.modHandler.GetRelatedMods(c, queryOption)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+	} else {
+		resp.Ok(ctx).Data(related).Do()
+	}
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/dstgo/tracker/internal/handler"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/resp"
+)
+
+type PlayerAPI struct {
+	playerHandler handler.PlayerHandler
+}
+
+// Search [GET] /player/search?name=wilson or /player/search?netid=KU_xxxxxxxx
+// returns the servers that player has been seen on and when, the latest first
+func (p PlayerAPI) Search(c context.Context, ctx *app.RequestContext) {
+	var queryOption types.SearchPlayersOption
+	if err := ctx.BindAndValidate(&queryOption); err != nil {
+		resp.Failed(ctx).Error(err).Do()
+		return
+	}
+
+	sightings, err := p.playerHandler.SearchPlayers(c, queryOption)
+	if err != nil {
+		resp.Failed(ctx).Error(err).Do()
+	} else {
+		resp.Ok(ctx).Data(sightings).Do()
+	}
+}
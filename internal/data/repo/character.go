@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"context"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LobbyCharacterStatistic is the character picks of the crawled players at ts, grouped by region, platform and game mode.
+// The Label of character items is the prefab, TotalServers is the number of servers that the character presented in.
+type LobbyCharacterStatistic struct {
+	Ts           int64  `json:"ts" bson:"ts"`
+	Region       string `json:"region" bson:"region"`
+	PlatformName string `json:"platformName" bson:"platform_name"`
+	GameMode     string `json:"mode" bson:"game_mode"`
+	// players who have picked characters
+	Players    int64                `json:"players" bson:"players"`
+	Characters []LobbyStatisticItem `json:"characters" bson:"characters"`
+}
+
+// LobbyCharactersQuery is the query options of GetCharacters, empty fields are ignored
+type LobbyCharactersQuery struct {
+	Region       string
+	PlatformName string
+	GameMode     string
+	// milliseconds timestamp range, both inclusive
+	From int64
+	To   int64
+	// bucket size in milliseconds
+	Step int64
+}
+
+// LobbyCharacterBucket is the sum of character statistics in single bucket
+type LobbyCharacterBucket struct {
+	// start of the bucket
+	Ts int64 `bson:"_id"`
+	// number of statistic timestamps in the bucket
+	Samples    int                  `bson:"samples"`
+	Characters []LobbyStatisticItem `bson:"characters"`
+}
+
+func (l *LobbyStatisticRepo) InsertCharacters(ctx context.Context, statistics []LobbyCharacterStatistic) error {
+	if len(statistics) == 0 {
+		return nil
+	}
+
+	_, err := l.characters.InsertMany(ctx, statistics)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetCharacters returns the character statistics matched the query and summed by buckets, in time order
+func (l *LobbyStatisticRepo) GetCharacters(ctx context.Context, query LobbyCharactersQuery) ([]LobbyCharacterBucket, error) {
+	match := bson.M{"ts": bson.M{"$gte": query.From, "$lte": query.To}}
+	if query.Region != "" {
+		match["region"] = query.Region
+	}
+	if query.PlatformName != "" {
+		match["platform_name"] = query.PlatformName
+	}
+	if query.GameMode != "" {
+		match["game_mode"] = query.GameMode
+	}
+
+	bucket := bson.M{"$subtract": bson.A{"$ts", bson.M{"$mod": bson.A{bson.M{"$subtract": bson.A{"$ts", query.From}}, query.Step}}}}
+
+	var result []LobbyCharacterBucket
+	err := l.characters.Aggregate(ctx, qmgo.Pipeline{
+		bson.D{{"$match", match}},
+		bson.D{{"$unwind", "$characters"}},
+		bson.D{{"$group", bson.M{
+			"_id":           bson.M{"bucket": bucket, "label": "$characters.label"},
+			"totalServers":  bson.M{"$sum": "$characters.totalServers"},
+			"onlinePlayers": bson.M{"$sum": "$characters.onlinePlayers"},
+			"ts":            bson.M{"$addToSet": "$ts"},
+		}}},
+		bson.D{{"$group", bson.M{
+			"_id": "$_id.bucket",
+			"characters": bson.M{"$push": bson.M{
+				"label":         "$_id.label",
+				"totalServers":  "$totalServers",
+				"onlinePlayers": "$onlinePlayers",
+			}},
+			"ts": bson.M{"$push": "$ts"},
+		}}},
+		// the distinct timestamps of all the characters in bucket
+		bson.D{{"$project", bson.M{
+			"characters": 1,
+			"samples": bson.M{"$size": bson.M{"$reduce": bson.M{
+				"input":        "$ts",
+				"initialValue": bson.A{},
+				"in":           bson.M{"$setUnion": bson.A{"$$value", "$$this"}},
+			}}},
+		}}},
+		bson.D{{"$sort", bson.M{"_id": 1}}},
+	}).All(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"github.com/qiniu/qmgo"
+	opts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LobbyCollectItem is the outcome of collecting servers for single region-platform pair
+type LobbyCollectItem struct {
+	Region   string `json:"region" bson:"region"`
+	Platform string `json:"platform" bson:"platform"`
+	// number of servers fetched
+	Servers int `json:"servers" bson:"servers"`
+	// milliseconds
+	Latency int64 `json:"latency" bson:"latency"`
+	// status code of lobby response, 0 if no response received
+	Status int    `json:"status,omitempty" bson:"status,omitempty"`
+	Error  string `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// LobbyCollectReport is the report of single collection run, Ts is the same as updated_at of the snapshot
+type LobbyCollectReport struct {
+	Ts int64 `json:"ts" bson:"ts"`
+	// milliseconds
+	Cost int64 `json:"cost" bson:"cost"`
+	// total servers collected
+	Servers   int `json:"servers" bson:"servers"`
+	Succeeded int `json:"succeeded" bson:"succeeded"`
+	Failed    int `json:"failed" bson:"failed"`
+	// error that aborted the whole run, such as failed to get regions
+	Error string             `json:"error,omitempty" bson:"error,omitempty"`
+	Items []LobbyCollectItem `json:"items" bson:"items"`
+}
+
+// NewLobbyCollectRepo returns new collection report mongo db operator
+func NewLobbyCollectRepo(ctx context.Context, cli *qmgo.QmgoClient) (*LobbyCollectRepo, error) {
+	col := cli.Database.Collection("lobby_collect")
+
+	err := col.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"ts"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LobbyCollectRepo{col: col}, nil
+}
+
+type LobbyCollectRepo struct {
+	col *qmgo.Collection
+}
+
+func (l *LobbyCollectRepo) InsertOne(ctx context.Context, report LobbyCollectReport) error {
+	_, err := l.col.InsertOne(ctx, report)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// GetMany returns the latest tail reports between before and until, newest first
+func (l *LobbyCollectRepo) GetMany(ctx context.Context, before, until, tail int64) ([]LobbyCollectReport, error) {
+	var result []LobbyCollectReport
+
+	if tail <= 0 {
+		tail = 10
+	}
+
+	err := l.col.Find(ctx, bson.M{"ts": bson.M{"$gte": before, "$lte": until}}).
+		Sort("-ts").
+		Limit(tail).
+		All(&result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// LastSucceeded returns the ts of the latest report that each region-platform pair succeeded in, keyed by [region, platform]
+func (l *LobbyCollectRepo) LastSucceeded(ctx context.Context) (map[[2]string]int64, error) {
+	var pairs []struct {
+		Pair LobbyCollectItem `bson:"_id"`
+		Ts   int64            `bson:"ts"`
+	}
+	err := l.col.Aggregate(ctx, qmgo.Pipeline{
+		bson.D{{"$unwind", "$items"}},
+		bson.D{{"$match", bson.M{"items.error": bson.M{"$in": bson.A{"", nil}}}}},
+		bson.D{{"$group", bson.M{
+			"_id": bson.M{"region": "$items.region", "platform": "$items.platform"},
+			"ts":  bson.M{"$max": "$ts"},
+		}}},
+	}).All(&pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[[2]string]int64, len(pairs))
+	for _, pair := range pairs {
+		result[[2]string{pair.Pair.Region, pair.Pair.Platform}] = pair.Ts
+	}
+	return result, nil
+}
+
+// RemoveBefore removes the reports that are created before ts
+func (l *LobbyCollectRepo) RemoveBefore(ctx context.Context, ts int64) (int64, error) {
+	result, err := l.col.RemoveAll(ctx, bson.M{"ts": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var (
+	// ErrInvalidCursor means that the cursor is malformed or does not match the query
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorExpired means that the snapshot which the cursor bound to has been removed
+	ErrCursorExpired = errors.New("cursor expired")
+)
+
+// cursor directions
+const (
+	cursorNext = 1
+	cursorPrev = -1
+)
+
+// Cursor is the position of pagination in single snapshot, it is encoded as opaque token for clients
+type Cursor struct {
+	// snapshot timestamp
+	Ts    int64       `bson:"ts"`
+	Sorts []SortField `bson:"sorts"`
+	// 1 for next page, -1 for previous page
+	Dir int `bson:"dir"`
+	// sort key values of the boundary item, in the same order as Sorts
+	Keys bson.D `bson:"keys"`
+}
+
+// EncodeCursor encodes the cursor into url safe token
+func EncodeCursor(cursor Cursor) (string, error) {
+	bytes, err := bson.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// DecodeCursor decodes the cursor from token
+func DecodeCursor(token string) (Cursor, error) {
+	var cursor Cursor
+
+	bytes, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return cursor, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	if err := bson.Unmarshal(bytes, &cursor); err != nil {
+		return cursor, fmt.Errorf("%w: %v", ErrInvalidCursor, err)
+	}
+
+	if cursor.Dir != cursorNext && cursor.Dir != cursorPrev {
+		return cursor, fmt.Errorf("%w: unknown direction %d", ErrInvalidCursor, cursor.Dir)
+	}
+
+	if len(cursor.Keys) != len(cursor.Sorts) {
+		return cursor, fmt.Errorf("%w: keys mismatched with sorts", ErrInvalidCursor)
+	}
+
+	// keys go into the query, documents could carry operators such as $regex or $where
+	for _, key := range cursor.Keys {
+		switch key.Value.(type) {
+		case string, int32, int64, float64, bool, nil:
+		default:
+			return cursor, fmt.Errorf("%w: key %q is not scalar", ErrInvalidCursor, key.Key)
+		}
+	}
+
+	return cursor, nil
+}
+
+// checkCursorTs returns ErrCursorExpired if the cursor is bound to neither the latest snapshot
+// nor the retained ones since oldest, oldest is 0 if no snapshots retained.
+func checkCursorTs(cursor Cursor, latest, oldest int64) error {
+	if cursor.Ts == latest {
+		return nil
+	}
+	if oldest == 0 || cursor.Ts < oldest || cursor.Ts > latest {
+		return ErrCursorExpired
+	}
+	return nil
+}
+
+// cursorKeys returns the sort key values of the document
+func cursorKeys(doc bson.Raw, sorts []SortField) bson.D {
+	keys := make(bson.D, 0, len(sorts))
+	for _, sort := range sorts {
+		keys = append(keys, bson.E{Key: sort.Field, Value: doc.Lookup(sort.Field)})
+	}
+	return keys
+}
+
+// keysetFilter matches the documents after the keys in the direction, for sorts [a, b] it looks like:
+//
+//	{$or: [{a: {$gt: ka}}, {a: ka, b: {$gt: kb}}]}
+func keysetFilter(sorts []SortField, keys bson.D, dir int) bson.M {
+	var or bson.A
+	for i, sort := range sorts {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sorts[j].Field] = keys[j].Value
+		}
+
+		op := "$gt"
+		if sort.Order*dir < 0 {
+			op = "$lt"
+		}
+		cond[sort.Field] = bson.M{op: keys[i].Value}
+
+		or = append(or, cond)
+	}
+	return bson.M{"$or": or}
+}
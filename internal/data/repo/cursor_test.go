@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"errors"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	sorts := withTiebreaker([]SortField{{Field: "connected", Order: -1}})
+	doc, err := bson.Marshal(bson.M{"connected": 6, "row_id": "KU_nnMF5SAo", "name": "foo"})
+	assert.Nil(t, err)
+
+	token, err := EncodeCursor(Cursor{Ts: 1700000000000, Sorts: sorts, Dir: cursorNext, Keys: cursorKeys(doc, sorts)})
+	assert.Nil(t, err)
+
+	cursor, err := DecodeCursor(token)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, int64(1700000000000), cursor.Ts)
+	assert.DeepEqual(t, sorts, cursor.Sorts)
+	assert.DeepEqual(t, bson.D{{"connected", int32(6)}, {"row_id", "KU_nnMF5SAo"}}, cursor.Keys)
+}
+
+func TestDecodeInvalidCursor(t *testing.T) {
+	for _, token := range []string{"", "!!!", "e30"} {
+		_, err := DecodeCursor(token)
+		assert.True(t, errors.Is(err, ErrInvalidCursor))
+	}
+}
+
+func TestDecodeCursorOperators(t *testing.T) {
+	sorts := []SortField{{Field: "name", Order: 1}}
+	for _, value := range []any{
+		bson.D{{"$regex", "(a+)+$"}},
+		bson.D{{"$where", "sleep(1000)"}},
+		bson.A{"foo"},
+	} {
+		token, err := EncodeCursor(Cursor{Ts: 1, Sorts: sorts, Dir: cursorNext, Keys: bson.D{{"name", value}}})
+		assert.Nil(t, err)
+
+		_, err = DecodeCursor(token)
+		assert.True(t, errors.Is(err, ErrInvalidCursor))
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	sorts := []SortField{{Field: "connected", Order: -1}, {Field: "row_id", Order: 1}}
+	keys := bson.D{{"connected", 6}, {"row_id", "KU_nnMF5SAo"}}
+
+	assert.DeepEqual(t, bson.M{"$or": bson.A{
+		bson.M{"connected": bson.M{"$lt": 6}},
+		bson.M{"connected": 6, "row_id": bson.M{"$gt": "KU_nnMF5SAo"}},
+	}}, keysetFilter(sorts, keys, cursorNext))
+
+	assert.DeepEqual(t, bson.M{"$or": bson.A{
+		bson.M{"connected": bson.M{"$gt": 6}},
+		bson.M{"connected": 6, "row_id": bson.M{"$lt": "KU_nnMF5SAo"}},
+	}}, keysetFilter(sorts, keys, cursorPrev))
+}
+
+func TestCheckCursorTs(t *testing.T) {
+	first, second := int64(1700000000000), int64(1700000120000)
+	cursor := Cursor{Ts: first, Dir: cursorNext}
+
+	// only the first snapshot stored
+	assert.Nil(t, checkCursorTs(cursor, first, first))
+
+	// paging across the second collection, the first snapshot is still retained
+	assert.Nil(t, checkCursorTs(cursor, second, first))
+
+	// the first snapshot has been removed after the grace window
+	third := first + snapshotGrace.Milliseconds() + 1
+	assert.True(t, errors.Is(checkCursorTs(cursor, third, snapshotCutoff(third)), ErrCursorExpired))
+
+	// nothing retained, or forged timestamp
+	assert.True(t, errors.Is(checkCursorTs(cursor, second, 0), ErrCursorExpired))
+	assert.True(t, errors.Is(checkCursorTs(Cursor{Ts: second + 1}, second, first), ErrCursorExpired))
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"github.com/qiniu/qmgo"
+	opts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// LobbyServerDetails is the crawled details of lobby server
+type LobbyServerDetails struct {
+	Region string `bson:"region"`
+	Area   string `bson:"area"`
+	// stable id of the logical server
+	ServerId string `bson:"server_id,omitempty"`
+	// timestamp of the snapshot that server belongs to
+	SnapshotTs int64 `bson:"snapshot_ts"`
+	// crawled at timestamp
+	CreatedAt              int64 `bson:"created_at"`
+	lobbyapi.ServerDetails `bson:"inline"`
+}
+
+// NewLobbyDetailsRepo returns new lobby details mongo db operator
+func NewLobbyDetailsRepo(ctx context.Context, cli *qmgo.QmgoClient) (*LobbyDetailsRepo, error) {
+	col := cli.Database.Collection("lobby_details")
+
+	err := col.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"row_id", "created_at"}, &options.IndexOptions{}},
+		{[]string{"server_id", "created_at"}, &options.IndexOptions{}},
+		{[]string{"created_at"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LobbyDetailsRepo{col: col}, nil
+}
+
+type LobbyDetailsRepo struct {
+	col *qmgo.Collection
+}
+
+func (l *LobbyDetailsRepo) InsertMany(ctx context.Context, details []LobbyServerDetails) (int, error) {
+	result, err := l.col.InsertMany(ctx, details)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.InsertedIDs), nil
+}
+
+// FindDays returns the day info of the rowIds crawled between from and to, in time order
+func (l *LobbyDetailsRepo) FindDays(ctx context.Context, rowIds []string, from, to int64) ([]LobbyServerDetails, error) {
+	var details []LobbyServerDetails
+	err := l.col.Find(ctx, bson.M{"row_id": bson.M{"$in": rowIds}, "created_at": bson.M{"$gte": from, "$lte": to}}).
+		Select(bson.M{"created_at": 1, "details.day": 1, "details.day_elapsed_in_season": 1, "details.days_left_in_season": 1}).
+		Sort("created_at").
+		All(&details)
+	if err != nil {
+		return nil, err
+	}
+	return details, nil
+}
+
+// FindLatestDays returns the latest day of each server crawled before ts, keyed by server id
+func (l *LobbyDetailsRepo) FindLatestDays(ctx context.Context, serverIds []string, before int64) (map[string]int, error) {
+	var latest []struct {
+		ServerId string `bson:"_id"`
+		Day      int    `bson:"day"`
+	}
+	pipeline := qmgo.Pipeline{
+		bson.D{{"$match", bson.M{"server_id": bson.M{"$in": serverIds}, "created_at": bson.M{"$lt": before}}}},
+		bson.D{{"$sort", bson.D{{"created_at", -1}}}},
+		bson.D{{"$group", bson.M{"_id": "$server_id", "day": bson.M{"$first": "$details.day"}}}},
+	}
+	if err := l.col.Aggregate(ctx, pipeline).All(&latest); err != nil {
+		return nil, err
+	}
+
+	days := make(map[string]int, len(latest))
+	for _, item := range latest {
+		days[item.ServerId] = item.Day
+	}
+	return days, nil
+}
+
+// RemoveBefore removes the details that are crawled before ts
+func (l *LobbyDetailsRepo) RemoveBefore(ctx context.Context, ts int64) (int64, error) {
+	result, err := l.col.RemoveAll(ctx, bson.M{"created_at": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,155 @@
+package repo
+
+import (
+	"context"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/qiniu/qmgo"
+	opts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// lifecycle event types of lobby server
+const (
+	// EventAppeared means that the server came online
+	EventAppeared = "appeared"
+	// EventDisappeared means that the server went offline
+	EventDisappeared = "disappeared"
+	// EventRestarted means that the server came back with a new rowId
+	EventRestarted = "restarted"
+	// EventWiped means that the world of server was regenerated, the day counter reset
+	EventWiped = "wiped"
+)
+
+// LobbyServerEvent is the lifecycle event of logical server
+type LobbyServerEvent struct {
+	Type         string `json:"type" bson:"type"`
+	Ts           int64  `json:"ts" bson:"ts"`
+	ServerId     string `json:"serverId" bson:"server_id"`
+	RowId        string `json:"rowId" bson:"row_id"`
+	Region       string `json:"region" bson:"region"`
+	PlatformName string `json:"platformName" bson:"platform_name"`
+	Name         string `json:"name" bson:"name"`
+
+	// previous rowId of restarted event
+	PrevRowId string `json:"prevRowId,omitempty" bson:"prev_row_id,omitempty"`
+	// days of wiped event
+	Day     int `json:"day,omitempty" bson:"day,omitempty"`
+	PrevDay int `json:"prevDay,omitempty" bson:"prev_day,omitempty"`
+}
+
+// LobbyEventsQuery is the query options of FindEvents, empty fields are ignored
+type LobbyEventsQuery struct {
+	Page     int
+	Size     int
+	ServerId string
+	Region   string
+	Types    []string
+	// milliseconds timestamp range, both inclusive
+	From int64
+	To   int64
+}
+
+// NewLobbyEventRepo returns new lobby events mongo db operator
+func NewLobbyEventRepo(ctx context.Context, cli *qmgo.QmgoClient) (*LobbyEventRepo, error) {
+	col := cli.Database.Collection("lobby_events")
+
+	err := col.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"ts"}, &options.IndexOptions{}},
+		{[]string{"server_id", "ts"}, &options.IndexOptions{}},
+		{[]string{"region", "ts"}, &options.IndexOptions{}},
+		{[]string{"type", "ts"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LobbyEventRepo{col: col}, nil
+}
+
+type LobbyEventRepo struct {
+	col *qmgo.Collection
+}
+
+func (l *LobbyEventRepo) InsertMany(ctx context.Context, events []LobbyServerEvent) (int, error) {
+	if len(events) == 0 {
+		return 0, nil
+	}
+
+	result, err := l.col.InsertMany(ctx, events)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.InsertedIDs), nil
+}
+
+// FindEvents returns the events matched the query by page, newest first
+func (l *LobbyEventRepo) FindEvents(ctx context.Context, query LobbyEventsQuery) (types.PageResult[LobbyServerEvent], error) {
+	var result types.PageResult[LobbyServerEvent]
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.Size <= 0 {
+		query.Size = 10
+	}
+
+	filter := bson.M{}
+	if query.ServerId != "" {
+		filter["server_id"] = query.ServerId
+	}
+	if query.Region != "" {
+		filter["region"] = query.Region
+	}
+	if len(query.Types) > 0 {
+		filter["type"] = bson.M{"$in": query.Types}
+	}
+	if query.From > 0 || query.To > 0 {
+		ts := bson.M{}
+		if query.From > 0 {
+			ts["$gte"] = query.From
+		}
+		if query.To > 0 {
+			ts["$lte"] = query.To
+		}
+		filter["ts"] = ts
+	}
+
+	total, err := l.col.Find(ctx, filter).Count()
+	if err != nil {
+		return result, err
+	}
+	result.Total = total
+
+	err = l.col.Find(ctx, filter).
+		Sort("-ts", "-_id").
+		Skip(int64((query.Page - 1) * query.Size)).
+		Limit(int64(query.Size)).
+		All(&result.List)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// FindServerEvents returns the events of the types that occurred to server until ts, in time order
+func (l *LobbyEventRepo) FindServerEvents(ctx context.Context, serverId string, eventTypes []string, until int64) ([]LobbyServerEvent, error) {
+	var events []LobbyServerEvent
+	err := l.col.Find(ctx, bson.M{"server_id": serverId, "type": bson.M{"$in": eventTypes}, "ts": bson.M{"$lte": until}}).
+		Sort("ts").
+		All(&events)
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// RemoveBefore removes the events that occurred before ts
+func (l *LobbyEventRepo) RemoveBefore(ctx context.Context, ts int64) (int64, error) {
+	result, err := l.col.RemoveAll(ctx, bson.M{"ts": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
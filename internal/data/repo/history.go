@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"context"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// LobbyServerHistory records the changed fields of server in single collection
+type LobbyServerHistory struct {
+	RowId    string `bson:"row_id"`
+	ServerId string `bson:"server_id,omitempty"`
+	Ts       int64  `bson:"ts"`
+	// whether the logical server first appeared at ts, if so Changes holds all the fields
+	Appeared bool `bson:"appeared,omitempty"`
+	// changed fields and their new values, keyed by bson field name
+	Changes bson.M `bson:"changes"`
+}
+
+// FindHistory returns the history of logical server recorded until ts across its rowIds, in time order
+func (l *LobbyRepo) FindHistory(ctx context.Context, server LobbyServer, until int64) ([]LobbyServerHistory, error) {
+	filter := bson.M{"ts": bson.M{"$lte": until}}
+	if server.ServerId != "" {
+		filter["server_id"] = server.ServerId
+	} else {
+		// recorded before the server ids were assigned
+		filter["row_id"] = server.RowId
+	}
+
+	var histories []LobbyServerHistory
+	err := l.history.Find(ctx, filter).Sort("ts").All(&histories)
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
+
+// RemoveHistoryBefore removes the history that recorded before ts. To keep the history replayable,
+// the removed records of the servers that still exist are compacted into one record at ts.
+func (l *LobbyRepo) RemoveHistoryBefore(ctx context.Context, ts int64) (int64, error) {
+	var compacted []LobbyServerHistory
+	pipeline := qmgo.Pipeline{
+		bson.D{{"$match", bson.M{"ts": bson.M{"$lte": ts}}}},
+		bson.D{{"$sort", bson.D{{"ts", 1}}}},
+		// the later changes override the earlier ones
+		bson.D{{"$group", bson.M{
+			"_id":       bson.M{"$ifNull": bson.A{"$server_id", "$row_id"}},
+			"row_id":    bson.M{"$last": "$row_id"},
+			"server_id": bson.M{"$last": "$server_id"},
+			"appeared":  bson.M{"$first": "$appeared"},
+			"changes":   bson.M{"$mergeObjects": "$changes"},
+		}}},
+		bson.D{{"$project", bson.M{"_id": 0, "row_id": 1, "server_id": 1, "ts": bson.M{"$literal": ts}, "appeared": 1, "changes": 1}}},
+	}
+	if err := l.history.Aggregate(ctx, pipeline).All(&compacted); err != nil {
+		return 0, err
+	}
+
+	exists := make(map[string]bool)
+	for _, field := range []string{"row_id", "server_id"} {
+		var existing []string
+		if err := l.collection.Find(ctx, bson.M{}).Distinct(field, &existing); err != nil {
+			return 0, err
+		}
+		for _, id := range existing {
+			exists[id] = true
+		}
+	}
+
+	result, err := l.history.RemoveAll(ctx, bson.M{"ts": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+
+	var bases []LobbyServerHistory
+	for _, history := range compacted {
+		if exists[history.RowId] || exists[history.ServerId] {
+			bases = append(bases, history)
+		}
+	}
+	if len(bases) > 0 {
+		if _, err := l.history.InsertMany(ctx, bases); err != nil {
+			return 0, err
+		}
+	}
+
+	return result.DeletedCount - int64(len(bases)), nil
+}
+
+// ReplayHistory applies the histories in order, and calls fn with the full state of server after each record.
+// The histories should start with the record that server appeared, or the compacted one.
+func ReplayHistory(histories []LobbyServerHistory, fn func(ts int64, server LobbyServer) error) error {
+	state := bson.M{}
+	for _, history := range histories {
+		for key, value := range history.Changes {
+			state[key] = value
+		}
+
+		doc, err := bson.Marshal(state)
+		if err != nil {
+			return err
+		}
+
+		var server LobbyServer
+		if err := bson.Unmarshal(doc, &server); err != nil {
+			return err
+		}
+
+		if err := fn(history.Ts, server); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// untrackedFields are the bookkeeping or derived fields that will not be recorded into history
+var untrackedFields = map[string]bool{
+	"_id":        true,
+	"created_at": true,
+	"updated_at": true,
+	"search":     true,
+	"free_slots": true,
+	"server_id":  true,
+	"mod_ids":    true,
+	"world_gen":  true,
+}
+
+// diffServer returns the tracked fields in doc that differ from current, all the tracked fields if current is nil
+func diffServer(current, doc bson.Raw) bson.M {
+	elements, err := doc.Elements()
+	if err != nil {
+		return nil
+	}
+
+	changes := bson.M{}
+	for _, element := range elements {
+		key := element.Key()
+		if untrackedFields[key] {
+			continue
+		}
+
+		value := element.Value()
+		if current != nil {
+			if old, err := current.LookupErr(key); err == nil && valueEqual(old, value) {
+				continue
+			}
+		}
+		changes[key] = value
+	}
+	return changes
+}
+
+// valueEqual reports whether the two values are equal, the order of fields in documents is ignored
+// because maps are marshalled in random order.
+func valueEqual(a, b bson.RawValue) bool {
+	if a.Type != bson.TypeEmbeddedDocument || b.Type != bson.TypeEmbeddedDocument {
+		return a.Equal(b)
+	}
+
+	aElements, err := a.Document().Elements()
+	if err != nil {
+		return false
+	}
+	bDoc := b.Document()
+	bElements, err := bDoc.Elements()
+	if err != nil || len(aElements) != len(bElements) {
+		return false
+	}
+
+	for _, element := range aElements {
+		value, err := bDoc.LookupErr(element.Key())
+		if err != nil || !valueEqual(element.Value(), value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package repo
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"go.mongodb.org/mongo-driver/bson"
+	"testing"
+)
+
+func marshalServer(t *testing.T, server LobbyServer) bson.Raw {
+	doc, err := bson.Marshal(server)
+	assert.Nil(t, err)
+	return doc
+}
+
+func TestDiffServer(t *testing.T) {
+	server := LobbyServer{
+		Region:    "ap-east-1",
+		CreatedAt: 1,
+		UpdatedAt: 1,
+		Server: lobbyapi.Server{
+			RowId:     "KU_nnMF5SAo",
+			Name:      "foo",
+			Connected: 2,
+			Secondaries: map[string]lobbyapi.Secondaries{
+				"a": {Id: "1"}, "b": {Id: "2"}, "c": {Id: "3"},
+			},
+		},
+	}
+	current := marshalServer(t, server)
+
+	// appeared
+	changes := diffServer(nil, current)
+	assert.DeepEqual(t, "foo", changes["name"].(bson.RawValue).StringValue())
+	assert.Nil(t, changes["updated_at"])
+
+	// only bookkeeping fields changed
+	server.UpdatedAt = 2
+	assert.DeepEqual(t, 0, len(diffServer(current, marshalServer(t, server))))
+
+	server.Connected = 3
+	server.Season = "winter"
+	changes = diffServer(current, marshalServer(t, server))
+	assert.DeepEqual(t, 2, len(changes))
+	assert.DeepEqual(t, int32(3), changes["connected"].(bson.RawValue).Int32())
+	assert.DeepEqual(t, "winter", changes["season"].(bson.RawValue).StringValue())
+}
+
+func TestReplayHistory(t *testing.T) {
+	histories := []LobbyServerHistory{
+		{RowId: "KU_nnMF5SAo", Ts: 1, Appeared: true, Changes: bson.M{"row_id": "KU_nnMF5SAo", "name": "foo", "connected": 1, "season": "autumn"}},
+		{RowId: "KU_nnMF5SAo", Ts: 2, Changes: bson.M{"connected": 4}},
+		{RowId: "KU_nnMF5SAo", Ts: 3, Changes: bson.M{"season": "winter", "server_paused": true}},
+	}
+
+	var servers []LobbyServer
+	err := ReplayHistory(histories, func(ts int64, server LobbyServer) error {
+		servers = append(servers, server)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 3, len(servers))
+
+	assert.DeepEqual(t, 1, servers[0].Connected)
+	assert.DeepEqual(t, 4, servers[1].Connected)
+	assert.DeepEqual(t, "autumn", servers[1].Season)
+	assert.DeepEqual(t, "winter", servers[2].Season)
+	assert.DeepEqual(t, "foo", servers[2].Name)
+	assert.True(t, servers[2].ServerPaused)
+}
@@ -2,12 +2,15 @@ package repo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"github.com/dstgo/tracker/internal/types"
 	"github.com/dstgo/tracker/pkg/lobbyapi"
 	"github.com/qiniu/qmgo"
 	opts "github.com/qiniu/qmgo/options"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"slices"
 	"time"
 )
 
@@ -19,21 +22,50 @@ type LobbyServer struct {
 	City         string   `bson:"city"`
 	PlatformName string   `bson:"platform_name"`
 	TagNames     []string `bson:"tag_names"`
-
-	// created at timestamp
-	CreatedAt       int64 `bson:"created_at"`
+	// max connections minus connected, stored for indexed query
+	FreeSlots int `bson:"free_slots"`
+	// tokenized texts for search
+	Search LobbySearchText `bson:"search"`
+
+	// stable id of the logical server, it is kept when the rowId changes, see handler.resolveServerIds
+	ServerId string `bson:"server_id"`
+	// workshop ids of the enabled mods from the latest crawled details, empty if never crawled.
+	// They are only written by UpdateModIds and kept by UpsertServers until the rowId changes,
+	// because mods could only be changed by restarting.
+	ModIds []string `bson:"mod_ids,omitempty"`
+	// world generation settings from the latest crawled details, nil if never crawled, kept the same as ModIds
+	WorldGen *LobbyWorldGen `bson:"world_gen,omitempty"`
+
+	// timestamp of the collection which the server first appeared in
+	CreatedAt int64 `bson:"created_at"`
+	// timestamp of the latest collection which the server presented in, servers of the latest snapshot share the same one
+	UpdatedAt       int64 `bson:"updated_at"`
 	lobbyapi.Server `bson:"inline"`
 }
 
-type LobbyServerDetails struct {
-	Area                   string
-	CreatedAt              int64
-	lobbyapi.ServerDetails `bson:"inline"`
+// LobbyWorldGen is the summary of the world generation settings, stored for filtering
+type LobbyWorldGen struct {
+	// preset ids of all shards, e.g. SURVIVAL_TOGETHER, LIGHTS_OUT, DST_CAVE
+	Presets []string `bson:"presets"`
+	// locations of all shards, e.g. forest, cave
+	Locations []string `bson:"locations"`
+
+	// frequently used overrides of the forest shard, or the first shard if there is no forest
+	TaskSet       string `bson:"task_set"`
+	WorldSize     string `bson:"world_size"`
+	StartLocation string `bson:"start_location"`
+	SeasonStart   string `bson:"season_start"`
 }
 
-// NewLobbyRepo returns new lobby mongo db operator
+// snapshotGrace is how long the previous snapshots are retained in lobby_snapshots after replaced,
+// so that the clients paging through one snapshot are not cut off by the newer collections.
+const snapshotGrace = 10 * time.Minute
+
+// NewLobbyRepo returns new lobby mongo db operator.
+// It keeps one current document per server in lobby_servers, and the changes of servers in lobby_history.
+// The snapshots of the last snapshotGrace are copied into lobby_snapshots for paging cursors.
 func NewLobbyRepo(ctx context.Context, db *qmgo.QmgoClient) (*LobbyRepo, error) {
-	col := db.Database.Collection("lobby")
+	col := db.Database.Collection("lobby_servers")
 
 	// create index
 	err := col.CreateIndexes(ctx, []opts.IndexModel{
@@ -41,22 +73,65 @@ func NewLobbyRepo(ctx context.Context, db *qmgo.QmgoClient) (*LobbyRepo, error)
 		{[]string{"area"}, &options.IndexOptions{}},
 		{[]string{"platform_name"}, &options.IndexOptions{}},
 		{[]string{"tag_names"}, &options.IndexOptions{}},
-		{[]string{"created_at"}, &options.IndexOptions{}},
-		{[]string{"row_id"}, &options.IndexOptions{}},
+		{[]string{"updated_at"}, &options.IndexOptions{}},
+		{[]string{"row_id"}, options.Index().SetUnique(true)},
+		{[]string{"server_id", "updated_at"}, &options.IndexOptions{}},
 		{[]string{"game_mode"}, &options.IndexOptions{}},
 		{[]string{"intent"}, &options.IndexOptions{}},
+		{[]string{"season"}, &options.IndexOptions{}},
+		{[]string{"version"}, &options.IndexOptions{}},
+		{[]string{"continent"}, &options.IndexOptions{}},
+		{[]string{"city"}, &options.IndexOptions{}},
+		// range queries always come with snapshot timestamp
+		{[]string{"updated_at", "connected"}, &options.IndexOptions{}},
+		{[]string{"updated_at", "free_slots"}, &options.IndexOptions{}},
+		{[]string{"updated_at", "mod_ids"}, &options.IndexOptions{}},
+		{[]string{"updated_at", "world_gen.presets"}, &options.IndexOptions{}},
+		// identity fields to link the restarted servers
+		{[]string{"guid"}, &options.IndexOptions{}},
+		{[]string{"steam_id"}, &options.IndexOptions{}},
+		{[]string{"owner_net_id"}, &options.IndexOptions{}},
+		{[]string{"address"}, &options.IndexOptions{}},
+		{[]string{"host"}, &options.IndexOptions{}},
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &LobbyRepo{cli: db, collection: col}, nil
+	if err := createSearchIndex(ctx, col); err != nil {
+		return nil, err
+	}
+
+	history := db.Database.Collection("lobby_history")
+	err = history.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"row_id", "ts"}, &options.IndexOptions{}},
+		{[]string{"server_id", "ts"}, &options.IndexOptions{}},
+		{[]string{"ts"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := db.Database.Collection("lobby_snapshots")
+	err = snapshots.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"updated_at"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := createSearchIndex(ctx, snapshots); err != nil {
+		return nil, err
+	}
+
+	return &LobbyRepo{cli: db, collection: col, history: history, snapshots: snapshots}, nil
 }
 
 type LobbyRepo struct {
 	cli        *qmgo.QmgoClient
 	collection *qmgo.Collection
+	history    *qmgo.Collection
+	snapshots  *qmgo.Collection
 }
 
 // RemoveServers returns deletedCount and total count after removing the specified servers
@@ -73,92 +148,614 @@ func (l *LobbyRepo) RemoveServers(ctx context.Context, filter bson.M) (int64, in
 	return result.DeletedCount, estimatedCount, nil
 }
 
-func (l *LobbyRepo) InsertManyServers(ctx context.Context, servers []LobbyServer) (int, error) {
-	// do transaction
-	result, err := l.collection.InsertMany(ctx, servers)
+// UpsertServers overwrites the current documents with the servers collected at ts except the crawled fields, and records their changes into history.
+// It returns the number of servers which appeared or changed.
+func (l *LobbyRepo) UpsertServers(ctx context.Context, ts int64, servers []LobbyServer) (int, error) {
+	changed, err := l.upsertServers(ctx, ts, servers)
 	if err != nil {
 		return 0, err
 	}
-	return len(result.InsertedIDs), nil
+
+	if err := l.retainSnapshot(ctx, ts); err != nil {
+		return 0, err
+	}
+
+	return changed, nil
 }
 
-// FindServers returns list of servers by page
-func (l *LobbyRepo) FindServers(ctx context.Context, page, size int, sort string, filter bson.M) (types.PageResult[LobbyServer], error) {
-	if page <= 0 {
-		page = 1
+// upsertServers is the same as UpsertServers, but the snapshot is not retained for cursors.
+// The history is written before the current documents and upserted by rowId and ts, so syncing the same snapshot again
+// after a failure in between is idempotent, and no current document is left without its history.
+func (l *LobbyRepo) upsertServers(ctx context.Context, ts int64, servers []LobbyServer) (int, error) {
+	rowIds := make([]string, 0, len(servers))
+	serverIds := make([]string, 0, len(servers))
+	for _, server := range servers {
+		rowIds = append(rowIds, server.RowId)
+		if server.ServerId != "" {
+			serverIds = append(serverIds, server.ServerId)
+		}
 	}
 
-	if size <= 0 {
-		size = 10
+	// the current documents to diff with, only the collected ones and the previous rowIds of them
+	var currents []bson.Raw
+	err := l.collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"row_id": bson.M{"$in": rowIds}},
+		bson.M{"server_id": bson.M{"$in": serverIds}},
+	}}).Select(bson.M{"_id": 0, "search": 0, "free_slots": 0}).All(&currents)
+	if err != nil {
+		return 0, err
 	}
 
-	if sort == "" {
-		sort = "name"
+	currentOf := make(map[string]bson.Raw, len(currents))
+	// the latest document of each logical server, used when its rowId changed
+	latestOf := make(map[string]bson.Raw, len(currents))
+	for _, current := range currents {
+		rowId, _ := current.Lookup("row_id").StringValueOK()
+		currentOf[rowId] = current
+
+		serverId, _ := current.Lookup("server_id").StringValueOK()
+		if serverId == "" {
+			continue
+		}
+		updatedAt, _ := current.Lookup("updated_at").AsInt64OK()
+		if latest, ok := latestOf[serverId]; ok {
+			if latestUpdatedAt, _ := latest.Lookup("updated_at").AsInt64OK(); latestUpdatedAt >= updatedAt {
+				continue
+			}
+		}
+		latestOf[serverId] = current
 	}
 
-	var result types.PageResult[LobbyServer]
-	lastTs := bson.M{}
+	var (
+		bulk      = l.collection.Bulk().SetOrdered(false)
+		histories []LobbyServerHistory
+		seen      = make(map[string]struct{}, len(servers))
+	)
+
+	for _, server := range servers {
+		// the same server may be listed more than once
+		if _, ok := seen[server.RowId]; ok {
+			continue
+		}
+		seen[server.RowId] = struct{}{}
+
+		server.Search = newLobbySearchText(server)
+		server.CreatedAt, server.UpdatedAt = ts, ts
+
+		// lobby does not list mods and worldgen, the crawled ones are left untouched, see UpdateModIds and UpdateWorldGens
+		server.ModIds = nil
+		server.WorldGen = nil
+
+		current, exists := currentOf[server.RowId]
+		// diff with the previous rowId of the same logical server
+		if !exists && server.ServerId != "" {
+			current, exists = latestOf[server.ServerId]
+		}
+		if exists {
+			if createdAt, ok := current.Lookup("created_at").AsInt64OK(); ok {
+				server.CreatedAt = createdAt
+			}
+		}
+
+		doc, err := bson.Marshal(server)
+		if err != nil {
+			return 0, err
+		}
+
+		if changes := diffServer(current, doc); len(changes) > 0 {
+			histories = append(histories, LobbyServerHistory{
+				RowId:    server.RowId,
+				ServerId: server.ServerId,
+				Ts:       ts,
+				Appeared: !exists,
+				Changes:  changes,
+			})
+		}
+
+		// $set instead of replacement, so the fields updated by the crawler meanwhile are kept
+		bulk.UpsertOne(bson.M{"row_id": server.RowId}, bson.M{"$set": bson.Raw(doc)})
+	}
+
+	if len(seen) == 0 {
+		return 0, nil
+	}
+
+	if len(histories) > 0 {
+		historyBulk := l.history.Bulk().SetOrdered(false)
+		for _, history := range histories {
+			historyBulk.Upsert(bson.M{"row_id": history.RowId, "ts": history.Ts}, history)
+		}
+		if _, err := historyBulk.Run(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := bulk.Run(ctx); err != nil {
+		return 0, err
+	}
+
+	return len(histories), nil
+}
 
-	// get the latest inserted timestamp
+// retainSnapshot copies the servers of snapshot ts into lobby_snapshots, and removes the snapshots out of the grace window
+func (l *LobbyRepo) retainSnapshot(ctx context.Context, ts int64) error {
+	// the snapshot may be copied before if the sync was retried
+	if _, err := l.snapshots.RemoveAll(ctx, bson.M{"updated_at": ts}); err != nil {
+		return err
+	}
+
+	var merged []bson.M
 	err := l.collection.Aggregate(ctx, qmgo.Pipeline{
-		bson.D{
-			{"$group", bson.M{"_id": "$created_at"}},
-		},
-		bson.D{
-			{"$sort", bson.M{"created": 1}},
-		},
-	}).One(&lastTs)
+		bson.D{{"$match", bson.M{"updated_at": ts}}},
+		// the copies get their own ids
+		bson.D{{"$unset", "_id"}},
+		bson.D{{"$merge", bson.M{"into": l.snapshots.GetCollectionName(), "whenNotMatched": "insert"}}},
+	}).All(&merged)
+	if err != nil {
+		return err
+	}
+
+	_, err = l.snapshots.RemoveAll(ctx, bson.M{"updated_at": bson.M{"$lt": snapshotCutoff(ts)}})
+	return err
+}
+
+// snapshotCutoff returns the timestamp before which the snapshots are removed when the snapshot ts is stored
+func snapshotCutoff(ts int64) int64 {
+	return ts - snapshotGrace.Milliseconds()
+}
+
+// oldestSnapshotTs returns the timestamp of the oldest retained snapshot, returns 0 if there has no data
+func (l *LobbyRepo) oldestSnapshotTs(ctx context.Context) (int64, error) {
+	var oldest LobbyServer
+	err := l.snapshots.Find(ctx, bson.M{}).Sort("updated_at").Select(bson.M{"updated_at": 1}).One(&oldest)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return oldest.UpdatedAt, nil
+}
 
+// LatestTs returns the timestamp of the latest snapshot, returns 0 if there has no data
+func (l *LobbyRepo) LatestTs(ctx context.Context) (int64, error) {
+	var latest LobbyServer
+	err := l.collection.Find(ctx, bson.M{}).Sort("-updated_at").Select(bson.M{"updated_at": 1}).One(&latest)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return latest.UpdatedAt, nil
+}
+
+// FindServer returns the current document of server, returns qmgo.ErrNoSuchDocuments if not found
+func (l *LobbyRepo) FindServer(ctx context.Context, rowId string) (LobbyServer, error) {
+	var server LobbyServer
+	err := l.collection.Find(ctx, bson.M{"row_id": rowId}).One(&server)
+	return server, err
+}
+
+// FindServerById returns the latest document of the logical server, returns qmgo.ErrNoSuchDocuments if not found
+func (l *LobbyRepo) FindServerById(ctx context.Context, serverId string) (LobbyServer, error) {
+	var server LobbyServer
+	err := l.collection.Find(ctx, bson.M{"server_id": serverId}).Sort("-updated_at").One(&server)
+	return server, err
+}
+
+// FindServerIds returns the server ids of the rowIds, the unknown rowIds are absent
+func (l *LobbyRepo) FindServerIds(ctx context.Context, rowIds []string) (map[string]string, error) {
+	var servers []LobbyServer
+	err := l.collection.Find(ctx, bson.M{"row_id": bson.M{"$in": rowIds}}).
+		Select(bson.M{"row_id": 1, "server_id": 1}).
+		All(&servers)
 	if err != nil {
-		return result, err
+		return nil, err
+	}
+
+	ids := make(map[string]string, len(servers))
+	for _, server := range servers {
+		ids[server.RowId] = server.ServerId
+	}
+	return ids, nil
+}
+
+// identityFields are the fields to link servers, and the fields of events, see handler.resolveServerIds and handler.diffSnapshots
+var identityFields = bson.M{
+	"server_id": 1, "row_id": 1, "region": 1, "platform": 1, "platform_name": 1, "updated_at": 1,
+	"guid": 1, "steam_id": 1, "owner_net_id": 1, "address": 1, "port": 1, "host": 1, "name": 1,
+}
+
+// FindIdentities returns the identity fields of the known servers that could be the collected ones,
+// that is the ones with the same rowIds, and the ones sharing any identity field with the servers of unknown rowIds.
+func (l *LobbyRepo) FindIdentities(ctx context.Context, servers []LobbyServer) ([]LobbyServer, error) {
+	rowIds := make([]string, 0, len(servers))
+	for _, server := range servers {
+		rowIds = append(rowIds, server.RowId)
+	}
+
+	var known []LobbyServer
+	err := l.collection.Find(ctx, bson.M{"row_id": bson.M{"$in": rowIds}}).Select(identityFields).All(&known)
+	if err != nil {
+		return nil, err
+	}
+
+	knownRowIds := make(map[string]bool, len(known))
+	for _, server := range known {
+		knownRowIds[server.RowId] = true
+	}
+
+	var guids, steamIds, ownerNetIds, addresses, hosts []string
+	for _, server := range servers {
+		if knownRowIds[server.RowId] {
+			continue
+		}
+		if server.Guid != "" {
+			guids = append(guids, server.Guid)
+		}
+		if server.SteamId != "" {
+			steamIds = append(steamIds, server.SteamId)
+		}
+		if server.OwnerNetId != "" {
+			ownerNetIds = append(ownerNetIds, server.OwnerNetId)
+		}
+		if server.Address != "" {
+			addresses = append(addresses, server.Address)
+		}
+		if server.Host != "" {
+			hosts = append(hosts, server.Host)
+		}
+	}
+
+	var conds bson.A
+	for field, values := range map[string][]string{
+		"guid": guids, "steam_id": steamIds, "owner_net_id": ownerNetIds, "address": addresses, "host": hosts,
+	} {
+		if len(values) > 0 {
+			conds = append(conds, bson.M{field: bson.M{"$in": values}})
+		}
+	}
+	if len(conds) == 0 {
+		return known, nil
+	}
+
+	var candidates []LobbyServer
+	err = l.collection.Find(ctx, bson.M{"$or": conds}).Select(identityFields).All(&candidates)
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range candidates {
+		if !knownRowIds[candidate.RowId] {
+			known = append(known, candidate)
+		}
+	}
+	return known, nil
+}
+
+// FindSnapshots returns the identity fields of the servers in the snapshots at the given timestamps
+func (l *LobbyRepo) FindSnapshots(ctx context.Context, ts []int64) ([]LobbyServer, error) {
+	var servers []LobbyServer
+	err := l.collection.Find(ctx, bson.M{"updated_at": bson.M{"$in": ts}}).Select(identityFields).All(&servers)
+	if err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// UpdateModIds sets the mod ids of servers keyed by rowId
+func (l *LobbyRepo) UpdateModIds(ctx context.Context, modIds map[string][]string) error {
+	if len(modIds) == 0 {
+		return nil
+	}
+
+	bulk := l.collection.Bulk().SetOrdered(false)
+	for rowId, ids := range modIds {
+		bulk.UpdateOne(bson.M{"row_id": rowId}, bson.M{"$set": bson.M{"mod_ids": ids}})
+	}
+	// the servers removed since crawled are not matched, it is not an error
+	_, err := bulk.Run(ctx)
+	return err
+}
+
+// UpdateWorldGens sets the world generation settings of servers keyed by rowId
+func (l *LobbyRepo) UpdateWorldGens(ctx context.Context, worldGens map[string]LobbyWorldGen) error {
+	if len(worldGens) == 0 {
+		return nil
+	}
+
+	bulk := l.collection.Bulk().SetOrdered(false)
+	for rowId, worldGen := range worldGens {
+		bulk.UpdateOne(bson.M{"row_id": rowId}, bson.M{"$set": bson.M{"world_gen": worldGen}})
+	}
+	// the servers removed since crawled are not matched, it is not an error
+	_, err := bulk.Run(ctx)
+	return err
+}
+
+// FindModSets returns the mod ids of the crawled servers at ts that enabled the mod
+func (l *LobbyRepo) FindModSets(ctx context.Context, ts int64, modId string) ([][]string, error) {
+	var servers []LobbyServer
+	err := l.collection.Find(ctx, bson.M{"updated_at": ts, "mod_ids": modId}).Select(bson.M{"mod_ids": 1}).All(&servers)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := make([][]string, 0, len(servers))
+	for _, server := range servers {
+		sets = append(sets, server.ModIds)
+	}
+	return sets, nil
+}
+
+// CountMods returns how many crawled servers at ts enabled each of the mods, and the total crawled servers
+func (l *LobbyRepo) CountMods(ctx context.Context, ts int64, modIds []string) (map[string]int, int64, error) {
+	crawled := bson.M{"updated_at": ts, "mod_ids": bson.M{"$exists": true}}
+
+	total, err := l.collection.Find(ctx, crawled).Count()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var counts []struct {
+		ModId   string `bson:"_id"`
+		Servers int    `bson:"servers"`
+	}
+	err = l.collection.Aggregate(ctx, qmgo.Pipeline{
+		bson.D{{"$match", crawled}},
+		bson.D{{"$unwind", "$mod_ids"}},
+		bson.D{{"$match", bson.M{"mod_ids": bson.M{"$in": modIds}}}},
+		bson.D{{"$group", bson.M{"_id": "$mod_ids", "servers": bson.M{"$sum": 1}}}},
+	}).All(&counts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make(map[string]int, len(counts))
+	for _, count := range counts {
+		result[count.ModId] = count.Servers
+	}
+	return result, total, nil
+}
+
+// FindTopServers returns at most limit servers of the snapshot at ts, ordered by online players desc, 0 limit means no limit
+func (l *LobbyRepo) FindTopServers(ctx context.Context, ts int64, limit int64) ([]LobbyServer, error) {
+	var servers []LobbyServer
+	err := l.collection.Find(ctx, bson.M{"updated_at": ts}).Sort("-connected").Limit(limit).All(&servers)
+	if err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// SortField specifies the field and direction to sort
+type SortField struct {
+	Field string `bson:"field"`
+	// 1 for ascending, -1 for descending
+	Order int `bson:"order"`
+}
+
+// withTiebreaker appends row_id to sorts to keep order stable
+func withTiebreaker(sorts []SortField) []SortField {
+	for _, sort := range sorts {
+		if sort.Field == "row_id" {
+			return sorts
+		}
+	}
+	return append(slices.Clip(sorts), SortField{Field: "row_id", Order: 1})
+}
+
+// sortStage builds $sort stage from sort fields, dir -1 reverses all the orders
+func sortStage(sorts []SortField, dir int) bson.D {
+	var keys bson.D
+	for _, sort := range sorts {
+		keys = append(keys, bson.E{Key: sort.Field, Value: sort.Order * dir})
+	}
+	return bson.D{{"$sort", keys}}
+}
+
+// sortKeys is the same as sortStage, but returns keys like "-field" for find
+func sortKeys(sorts []SortField, dir int) []string {
+	var keys []string
+	for _, sort := range sorts {
+		if sort.Order*dir < 0 {
+			keys = append(keys, "-"+sort.Field)
+		} else {
+			keys = append(keys, sort.Field)
+		}
+	}
+	return keys
+}
+
+// LobbyServersQuery is the query options of FindServers
+type LobbyServersQuery struct {
+	Page  int
+	Size  int
+	Sorts []SortField
+	// fields filter, the snapshot timestamp will be specified by FindServers
+	Filter bson.M
+	// full-text search over name, tags and host, the relevance could be sorted by ScoreField
+	Search string
+	// continue from the cursor if not empty, and Page will be ignored
+	Cursor string
+}
+
+// FindServers returns list of servers in single snapshot, paginated by page or cursor.
+// The returned cursors are bound to the snapshot, so the client will never see a newer snapshot while paging.
+// The replaced snapshots are served from lobby_snapshots, the cursors expire with ErrCursorExpired once they are removed.
+func (l *LobbyRepo) FindServers(ctx context.Context, query LobbyServersQuery) (types.PageResult[LobbyServer], error) {
+	var result types.PageResult[LobbyServer]
+
+	page, size := query.Page, query.Size
+	if page <= 0 {
+		page = 1
+	}
+
+	if size <= 0 {
+		size = 10
+	}
+
+	sorts := query.Sorts
+	if len(sorts) == 0 {
+		sorts = []SortField{{Field: "name", Order: 1}}
+	}
+	sorts = withTiebreaker(sorts)
+
+	var (
+		ts     int64
+		dir    = cursorNext
+		keyset bson.M
+		col    = l.collection
+	)
+
+	if query.Cursor != "" {
+		cursor, err := DecodeCursor(query.Cursor)
+		if err != nil {
+			return result, err
+		}
+
+		if !slices.Equal(cursor.Sorts, sorts) {
+			return result, fmt.Errorf("%w: sort mismatched", ErrInvalidCursor)
+		}
+
+		// the documents of disappeared servers keep the old timestamps, so compare with the latest snapshot
+		latest, err := l.LatestTs(ctx)
+		if err != nil {
+			return result, err
+		}
+		if cursor.Ts != latest {
+			oldest, err := l.oldestSnapshotTs(ctx)
+			if err != nil {
+				return result, err
+			}
+			if err := checkCursorTs(cursor, latest, oldest); err != nil {
+				return result, err
+			}
+			// the snapshot has been replaced, serve the retained copy
+			col = l.snapshots
+		}
+
+		ts, dir = cursor.Ts, cursor.Dir
+		keyset = keysetFilter(sorts, cursor.Keys, dir)
+	} else {
+		// get the latest inserted timestamp
+		latest, err := l.LatestTs(ctx)
+		if err != nil {
+			return result, err
+		}
+		ts = latest
 	}
 
 	// mean to there has no data in database
-	if len(lastTs) == 0 {
+	if ts == 0 {
 		return result, nil
 	}
 
-	// specify latest timestamp
-	ts := lastTs["_id"]
-	filter["created_at"] = ts
+	// specify snapshot timestamp
+	filter := bson.M{"updated_at": ts}
+	for key, value := range query.Filter {
+		filter[key] = value
+	}
 
-	// total count
-	total, err := l.collection.Find(ctx, bson.M{"created_at": ts}).EstimatedCount()
+	var textual bool
+	if query.Search != "" {
+		var searchM bson.M
+		searchM, textual = searchFilter(query.Search)
+		for key, value := range searchM {
+			filter[key] = value
+		}
+	}
+
+	// total count of filtered servers
+	total, err := countServers(ctx, col, filter)
 	if err != nil {
 		return result, err
 	}
 	result.Total = total
 
-	// match
-	matchStage := bson.D{{"$match", filter}}
-	// distinct by grow_id and returns object_id for per item
-	groupStage := bson.D{{"$group", bson.M{"_id": "$row_id", "object_id": bson.M{"$first": "$_id"}}}}
-	// pagination
-	skipStage := bson.D{{"$skip", (page - 1) * size}}
-	limitStage := bson.D{{"$limit", size}}
-
-	// filter results and distinct by row_id, then pagination
-	var objs []bson.M
-	err = l.collection.Aggregate(ctx, qmgo.Pipeline{matchStage, groupStage, skipStage, limitStage}).All(&objs)
+	var docs []bson.Raw
+	if textual {
+		// relevance score is only available in aggregation, and $text must be in the first stage
+		pipeline := qmgo.Pipeline{
+			bson.D{{"$match", filter}},
+			bson.D{{"$addFields", bson.M{ScoreField: bson.M{"$meta": "textScore"}}}},
+		}
+		if keyset != nil {
+			pipeline = append(pipeline, bson.D{{"$match", keyset}})
+		}
+		pipeline = append(pipeline, sortStage(sorts, dir))
+		if keyset == nil {
+			pipeline = append(pipeline, bson.D{{"$skip", (page - 1) * size}})
+		}
+		// fetch one more to know whether there is more
+		pipeline = append(pipeline, bson.D{{"$limit", size + 1}})
+
+		err = col.Aggregate(ctx, pipeline).All(&docs)
+	} else {
+		match := filter
+		if keyset != nil {
+			match = bson.M{"$and": bson.A{filter, keyset}}
+		}
+
+		// fetch one more to know whether there is more
+		find := col.Find(ctx, match).Sort(sortKeys(sorts, dir)...).Limit(int64(size + 1))
+		if keyset == nil {
+			find = find.Skip(int64((page - 1) * size))
+		}
+
+		err = find.All(&docs)
+	}
 	if err != nil {
 		return result, err
 	}
 
-	// collect object_id
-	var ids []any
-	for _, obj := range objs {
-		ids = append(ids, obj["object_id"])
+	hasMore := len(docs) > size
+	if hasMore {
+		docs = docs[:size]
 	}
 
-	// find final result
-	err = l.collection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}}).All(&result.List)
-	if err != nil {
-		return result, err
+	// previous page is fetched in reversed order
+	if dir == cursorPrev {
+		slices.Reverse(docs)
+	}
+
+	for _, doc := range docs {
+		var server LobbyServer
+		if err := bson.Unmarshal(doc, &server); err != nil {
+			return result, err
+		}
+		result.List = append(result.List, server)
+	}
+
+	if len(docs) == 0 {
+		return result, nil
+	}
+
+	hasNext, hasPrev := hasMore, page > 1
+	if keyset != nil {
+		hasNext, hasPrev = dir == cursorPrev || hasMore, dir == cursorNext || hasMore
+	}
+
+	if hasNext {
+		result.Next, err = EncodeCursor(Cursor{Ts: ts, Sorts: sorts, Dir: cursorNext, Keys: cursorKeys(docs[len(docs)-1], sorts)})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if hasPrev {
+		result.Prev, err = EncodeCursor(Cursor{Ts: ts, Sorts: sorts, Dir: cursorPrev, Keys: cursorKeys(docs[0], sorts)})
+		if err != nil {
+			return result, err
+		}
 	}
 
 	return result, nil
 }
 
+// countServers returns the number of servers in col matched the filter
+func countServers(ctx context.Context, col *qmgo.Collection, filter bson.M) (int64, error) {
+	return col.Find(ctx, filter).Count()
+}
+
 type LobbyStatisticItem struct {
 	Label         string `json:"label:" bson:"label"`
 	TotalServers  int64  `json:"totalServers" bson:"totalServers"`
@@ -174,12 +771,26 @@ type LobbyStatisticInfo struct {
 	Ts        int64                `json:"ts" bson:"ts"`
 }
 
-func NewLobbyStatisticRepo(cli *qmgo.QmgoClient) *LobbyStatisticRepo {
-	return &LobbyStatisticRepo{col: cli.Database.Collection("lobby_sum")}
+func NewLobbyStatisticRepo(ctx context.Context, cli *qmgo.QmgoClient) (*LobbyStatisticRepo, error) {
+	characters := cli.Database.Collection("lobby_characters")
+
+	err := characters.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"ts"}, &options.IndexOptions{}},
+		{[]string{"region", "ts"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &LobbyStatisticRepo{
+		col:        cli.Database.Collection("lobby_sum"),
+		characters: characters,
+	}, nil
 }
 
 type LobbyStatisticRepo struct {
-	col *qmgo.Collection
+	col        *qmgo.Collection
+	characters *qmgo.Collection
 }
 
 func (l *LobbyStatisticRepo) InsertOne(ctx context.Context, data LobbyStatisticInfo) error {
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"slices"
+)
+
+// legacyLobbyCollection stored the full snapshots of every collection, before lobby_servers and lobby_history
+const legacyLobbyCollection = "lobby"
+
+// MigrateLegacySnapshots replays the snapshots in the legacy collection into the current documents and history in time order,
+// then drops the legacy collection. It returns the number of snapshots replayed, and it is a no-op once the legacy collection is gone.
+// The snapshots not newer than the latest current one are skipped, so it resumes from where it was interrupted.
+func (l *LobbyRepo) MigrateLegacySnapshots(ctx context.Context) (int, error) {
+	legacy := l.cli.Database.Collection(legacyLobbyCollection)
+
+	count, err := legacy.Find(ctx, bson.M{}).EstimatedCount()
+	if err != nil {
+		return 0, err
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	latest, err := l.LatestTs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var snapshots []int64
+	if err := legacy.Find(ctx, bson.M{"created_at": bson.M{"$gt": latest}}).Distinct("created_at", &snapshots); err != nil {
+		return 0, err
+	}
+	slices.Sort(snapshots)
+
+	for _, ts := range snapshots {
+		// the legacy documents share the same fields, created_at was the snapshot timestamp
+		var servers []LobbyServer
+		if err := legacy.Find(ctx, bson.M{"created_at": ts}).All(&servers); err != nil {
+			return 0, err
+		}
+		// recorded before the server ids were assigned, see handler.serverIdOf
+		if _, err := l.upsertServers(ctx, ts, servers); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(snapshots), legacy.DropCollection(ctx)
+}
@@ -0,0 +1,219 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/qiniu/qmgo"
+	opts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ModUsageGroup is the usage of mod in single region-platform pair
+type ModUsageGroup struct {
+	Region       string `json:"region" bson:"region"`
+	PlatformName string `json:"platformName" bson:"platform_name"`
+	Servers      int64  `json:"servers" bson:"servers"`
+	Players      int64  `json:"players" bson:"players"`
+}
+
+// ModUsage is the usage of workshop mod among the servers crawled at ts
+type ModUsage struct {
+	Ts int64 `json:"ts" bson:"ts"`
+	// workshop id
+	ModId string `json:"id" bson:"mod_id"`
+	Name  string `json:"name" bson:"name"`
+	// servers that enabled the mod, and their online players
+	Servers int64           `json:"servers" bson:"servers"`
+	Players int64           `json:"players" bson:"players"`
+	Groups  []ModUsageGroup `json:"groups,omitempty" bson:"groups"`
+}
+
+// ModUsageQuery is the query options of mod usage, empty fields are ignored
+type ModUsageQuery struct {
+	Region       string
+	PlatformName string
+}
+
+// ModPopularQuery is the query options of FindPopular
+type ModPopularQuery struct {
+	ModUsageQuery
+	Page int
+	Size int
+	// servers or players
+	SortBy string
+}
+
+// ModUsageBucket is the sum of mod usage in single bucket
+type ModUsageBucket struct {
+	// start of the bucket
+	Ts      int64 `bson:"_id"`
+	Servers int64 `bson:"servers"`
+	Players int64 `bson:"players"`
+}
+
+// NewModRepo returns new mod usage mongo db operator
+func NewModRepo(ctx context.Context, cli *qmgo.QmgoClient) (*ModRepo, error) {
+	col := cli.Database.Collection("mod_usage")
+
+	err := col.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"ts", "servers"}, &options.IndexOptions{}},
+		{[]string{"ts", "players"}, &options.IndexOptions{}},
+		{[]string{"mod_id", "ts"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ModRepo{col: col}, nil
+}
+
+type ModRepo struct {
+	col *qmgo.Collection
+}
+
+func (m *ModRepo) InsertUsages(ctx context.Context, usages []ModUsage) (int, error) {
+	if len(usages) == 0 {
+		return 0, nil
+	}
+
+	result, err := m.col.InsertMany(ctx, usages)
+	if err != nil {
+		return 0, err
+	}
+	return len(result.InsertedIDs), nil
+}
+
+// LatestTs returns the timestamp of the latest mod usage, 0 if there is none
+func (m *ModRepo) LatestTs(ctx context.Context) (int64, error) {
+	var latest ModUsage
+	err := m.col.Find(ctx, bson.M{}).Sort("-ts").Select(bson.M{"ts": 1}).One(&latest)
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return latest.Ts, nil
+}
+
+// usageStages returns the stages that sum servers and players over the groups matched the query,
+// and drop the mods unused in them. No stages if the query is empty.
+func usageStages(query ModUsageQuery) []bson.D {
+	var conds bson.A
+	if query.Region != "" {
+		conds = append(conds, bson.M{"$eq": bson.A{"$$group.region", query.Region}})
+	}
+	if query.PlatformName != "" {
+		conds = append(conds, bson.M{"$eq": bson.A{"$$group.platform_name", query.PlatformName}})
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+
+	return []bson.D{
+		{{"$set", bson.M{"groups": bson.M{"$filter": bson.M{"input": "$groups", "as": "group", "cond": bson.M{"$and": conds}}}}}},
+		{{"$set", bson.M{"servers": bson.M{"$sum": "$groups.servers"}, "players": bson.M{"$sum": "$groups.players"}}}},
+		{{"$match", bson.M{"servers": bson.M{"$gt": 0}}}},
+	}
+}
+
+// FindPopular returns the mods of the usage at ts by page, the most used first
+func (m *ModRepo) FindPopular(ctx context.Context, ts int64, query ModPopularQuery) (types.PageResult[ModUsage], error) {
+	var result types.PageResult[ModUsage]
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.Size <= 0 {
+		query.Size = 10
+	}
+
+	primary, secondary := "servers", "players"
+	if query.SortBy == "players" {
+		primary, secondary = secondary, primary
+	}
+
+	pipeline := qmgo.Pipeline{bson.D{{"$match", bson.M{"ts": ts}}}}
+	pipeline = append(pipeline, usageStages(query.ModUsageQuery)...)
+	pipeline = append(pipeline,
+		bson.D{{"$sort", bson.D{{primary, -1}, {secondary, -1}, {"mod_id", 1}}}},
+		bson.D{{"$facet", bson.M{
+			"total": bson.A{bson.M{"$count": "count"}},
+			"list":  bson.A{bson.M{"$skip": (query.Page - 1) * query.Size}, bson.M{"$limit": query.Size}},
+		}}},
+	)
+
+	var facets []struct {
+		Total []struct {
+			Count int64 `bson:"count"`
+		} `bson:"total"`
+		List []ModUsage `bson:"list"`
+	}
+	if err := m.col.Aggregate(ctx, pipeline).All(&facets); err != nil {
+		return result, err
+	}
+
+	if len(facets) > 0 {
+		if len(facets[0].Total) > 0 {
+			result.Total = facets[0].Total[0].Count
+		}
+		result.List = facets[0].List
+	}
+	return result, nil
+}
+
+// FindUsage returns the usage of mod between from and to summed by buckets of step milliseconds, in time order
+func (m *ModRepo) FindUsage(ctx context.Context, modId string, from, to, step int64, query ModUsageQuery) ([]ModUsageBucket, error) {
+	bucket := bson.M{"$subtract": bson.A{"$ts", bson.M{"$mod": bson.A{bson.M{"$subtract": bson.A{"$ts", from}}, step}}}}
+
+	pipeline := qmgo.Pipeline{bson.D{{"$match", bson.M{"mod_id": modId, "ts": bson.M{"$gte": from, "$lte": to}}}}}
+	pipeline = append(pipeline, usageStages(query)...)
+	pipeline = append(pipeline,
+		bson.D{{"$group", bson.M{
+			"_id":     bucket,
+			"servers": bson.M{"$sum": "$servers"},
+			"players": bson.M{"$sum": "$players"},
+		}}},
+		bson.D{{"$sort", bson.M{"_id": 1}}},
+	)
+
+	var buckets []ModUsageBucket
+	if err := m.col.Aggregate(ctx, pipeline).All(&buckets); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// FindNames returns the names of mods in the usage at ts, keyed by workshop id
+func (m *ModRepo) FindNames(ctx context.Context, ts int64, modIds []string) (map[string]string, error) {
+	var usages []ModUsage
+	err := m.col.Find(ctx, bson.M{"ts": ts, "mod_id": bson.M{"$in": modIds}}).Select(bson.M{"mod_id": 1, "name": 1}).All(&usages)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]string, len(usages))
+	for _, usage := range usages {
+		names[usage.ModId] = usage.Name
+	}
+	return names, nil
+}
+
+// FindTs returns the distinct timestamps of the usages between from and to, that is when the details were crawled
+func (m *ModRepo) FindTs(ctx context.Context, from, to int64) ([]int64, error) {
+	var ts []int64
+	if err := m.col.Find(ctx, bson.M{"ts": bson.M{"$gte": from, "$lte": to}}).Distinct("ts", &ts); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+// RemoveBefore removes the usages before ts
+func (m *ModRepo) RemoveBefore(ctx context.Context, ts int64) (int64, error) {
+	result, err := m.col.RemoveAll(ctx, bson.M{"ts": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,148 @@
+package repo
+
+import (
+	"context"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/search"
+	"github.com/qiniu/qmgo"
+	opts "github.com/qiniu/qmgo/options"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+)
+
+// PlayerSighting is the continuous presence of player on single server,
+// the sightings of the same player and server are merged if the gap between them is short enough
+type PlayerSighting struct {
+	NetId string `json:"netId" bson:"net_id"`
+	Name  string `json:"name" bson:"name"`
+	// folded name for exact and prefix matching, see search.Fold
+	NameKey string `json:"-" bson:"name_key"`
+	// character of the latest sighting
+	Prefab string `json:"prefab" bson:"prefab"`
+	Colour string `json:"colour" bson:"colour"`
+
+	ServerId     string `json:"serverId" bson:"server_id"`
+	RowId        string `json:"rowId" bson:"row_id"`
+	Region       string `json:"region" bson:"region"`
+	PlatformName string `json:"platformName" bson:"platform_name"`
+	ServerName   string `json:"serverName" bson:"server_name"`
+
+	// milliseconds timestamp of the first and the latest crawl that player presented in
+	FirstSeen int64 `json:"firstSeen" bson:"first_seen"`
+	LastSeen  int64 `json:"lastSeen" bson:"last_seen"`
+}
+
+// PlayerSightingsQuery is the query options of FindSightings, either NetId or Name is required
+type PlayerSightingsQuery struct {
+	Page  int
+	Size  int
+	NetId string
+	// matched by prefix, case and full-width are ignored
+	Name string
+}
+
+// NewPlayerRepo returns new player sightings mongo db operator
+func NewPlayerRepo(ctx context.Context, cli *qmgo.QmgoClient) (*PlayerRepo, error) {
+	col := cli.Database.Collection("player_sightings")
+
+	err := col.CreateIndexes(ctx, []opts.IndexModel{
+		{[]string{"net_id", "server_id", "last_seen"}, &options.IndexOptions{}},
+		{[]string{"name_key", "last_seen"}, &options.IndexOptions{}},
+		{[]string{"last_seen"}, &options.IndexOptions{}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &PlayerRepo{col: col}, nil
+}
+
+type PlayerRepo struct {
+	col *qmgo.Collection
+}
+
+// UpsertSightings records the players seen at ts, the sighting of the same player and server is extended
+// if it was last seen after ts minus gap, otherwise a new one is started. It returns the number of new sightings.
+func (p *PlayerRepo) UpsertSightings(ctx context.Context, ts int64, gap int64, sightings []PlayerSighting) (int64, error) {
+	if len(sightings) == 0 {
+		return 0, nil
+	}
+
+	bulk := p.col.Bulk().SetOrdered(false)
+	for _, sighting := range sightings {
+		filter := bson.M{
+			"net_id":    sighting.NetId,
+			"server_id": sighting.ServerId,
+			"last_seen": bson.M{"$gte": ts - gap},
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"name":          sighting.Name,
+				"name_key":      search.Fold(sighting.Name),
+				"prefab":        sighting.Prefab,
+				"colour":        sighting.Colour,
+				"row_id":        sighting.RowId,
+				"region":        sighting.Region,
+				"platform_name": sighting.PlatformName,
+				"server_name":   sighting.ServerName,
+				"last_seen":     ts,
+			},
+			"$setOnInsert": bson.M{"first_seen": ts},
+		}
+		bulk.UpsertOne(filter, update)
+	}
+
+	result, err := bulk.Run(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return result.UpsertedCount, nil
+}
+
+// FindSightings returns the sightings of player by page, the latest first
+func (p *PlayerRepo) FindSightings(ctx context.Context, query PlayerSightingsQuery) (types.PageResult[PlayerSighting], error) {
+	var result types.PageResult[PlayerSighting]
+
+	if query.Page <= 0 {
+		query.Page = 1
+	}
+	if query.Size <= 0 {
+		query.Size = 10
+	}
+
+	filter := bson.M{}
+	if query.NetId != "" {
+		filter["net_id"] = query.NetId
+	}
+	if name := search.Fold(query.Name); name != "" {
+		// anchored prefix could use the index
+		filter["name_key"] = bson.M{"$regex": "^" + regexp.QuoteMeta(name)}
+	}
+
+	total, err := p.col.Find(ctx, filter).Count()
+	if err != nil {
+		return result, err
+	}
+	result.Total = total
+
+	err = p.col.Find(ctx, filter).
+		Sort("-last_seen", "-_id").
+		Skip(int64((query.Page - 1) * query.Size)).
+		Limit(int64(query.Size)).
+		All(&result.List)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// RemoveBefore removes the sightings that last seen before ts
+func (p *PlayerRepo) RemoveBefore(ctx context.Context, ts int64) (int64, error) {
+	result, err := p.col.RemoveAll(ctx, bson.M{"last_seen": bson.M{"$lte": ts}})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,67 @@
+package repo
+
+import (
+	"context"
+	"github.com/dstgo/tracker/pkg/search"
+	"github.com/qiniu/qmgo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
+)
+
+// ScoreField is the field of relevance score in search results, higher is more relevant
+const ScoreField = "score"
+
+// LobbySearchText holds the tokenized texts of server for text index, see package search
+type LobbySearchText struct {
+	Name string `bson:"name"`
+	Tags string `bson:"tags"`
+	Host string `bson:"host"`
+}
+
+// newLobbySearchText tokenizes the searchable fields of server
+func newLobbySearchText(server LobbyServer) LobbySearchText {
+	var tagTokens []string
+	for _, tag := range server.TagNames {
+		tagTokens = append(tagTokens, search.IndexTokens(tag)...)
+	}
+
+	return LobbySearchText{
+		Name: search.Text(search.IndexTokens(server.Name)),
+		Tags: search.Text(tagTokens),
+		Host: search.Text(search.IndexTokens(server.Host)),
+	}
+}
+
+// createSearchIndex creates text index over tokenized name, tags and host, name weighs the most
+func createSearchIndex(ctx context.Context, col *qmgo.Collection) error {
+	mcol, err := col.CloneCollection()
+	if err != nil {
+		return err
+	}
+
+	_, err = mcol.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{"search.name", "text"}, {"search.tags", "text"}, {"search.host", "text"}},
+		Options: options.Index().
+			SetName("search_text").
+			SetWeights(bson.D{{"search.name", 10}, {"search.tags", 3}, {"search.host", 1}}).
+			// tokens are produced by tokenizer, no stemming and stop words
+			SetDefaultLanguage("none"),
+	})
+	return err
+}
+
+// searchFilter returns the filter that matches the query, textual reports whether it is a $text query.
+// If there are no searchable tokens in query, such as emoji, it falls back to an escaped regex on name.
+func searchFilter(query string) (filter bson.M, textual bool) {
+	tokens := search.QueryTokens(query)
+	if len(tokens) > 0 {
+		return bson.M{"$text": bson.M{"$search": search.Text(tokens)}}, true
+	}
+
+	if runes := []rune(query); len(runes) > search.MaxQueryRunes {
+		query = string(runes[:search.MaxQueryRunes])
+	}
+	return bson.M{"name": bson.M{"$regex": regexp.QuoteMeta(query), "$options": "i"}}, false
+}
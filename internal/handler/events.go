@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"cmp"
+	"errors"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"slices"
+)
+
+// ErrInvalidEventType means that the event type filter contains unknown types
+var ErrInvalidEventType = errors.New("invalid event type")
+
+// collectPlatform returns the platform that the servers of p are collected with, see lobbyapi.ExplicitPlatforms
+func collectPlatform(p lobbyapi.Platform) string {
+	// PS4Official can not be queried, it is returned along with PSN
+	if p == lobbyapi.PS4Official {
+		return lobbyapi.PSN.String()
+	}
+	return p.String()
+}
+
+// newServerEvent returns the event of server without the type specific fields
+func newServerEvent(typ string, ts int64, server repo.LobbyServer) repo.LobbyServerEvent {
+	return repo.LobbyServerEvent{
+		Type:         typ,
+		Ts:           ts,
+		ServerId:     serverIdOf(server),
+		RowId:        server.RowId,
+		Region:       server.Region,
+		PlatformName: server.PlatformName,
+		Name:         server.Name,
+	}
+}
+
+// diffSnapshots returns the appeared, disappeared and restarted events between the previous snapshots and
+// the servers collected at ts, the server ids of servers should have been resolved.
+// The servers of the failed region-platform pairs in report are not considered disappeared, because they are unknown.
+// The previous snapshot of each pair is the one it last succeeded in, see repo.LobbyCollectRepo.LastSucceeded,
+// so the servers of the pairs that failed in the previous collections are not considered appeared once succeeded again.
+// The pairs without succeeded reports fall back to the latest snapshot.
+// No events if there is no previous snapshot, otherwise all the servers would appear at the first collection.
+func diffSnapshots(snapshots, servers []repo.LobbyServer, report repo.LobbyCollectReport, lastSucceeded map[[2]string]int64, ts int64) []repo.LobbyServerEvent {
+	var prevTs int64
+	for _, server := range snapshots {
+		prevTs = max(prevTs, server.UpdatedAt)
+	}
+	if prevTs == 0 {
+		return nil
+	}
+
+	previous := make(map[string]repo.LobbyServer)
+	for _, server := range snapshots {
+		pairTs, ok := lastSucceeded[[2]string{server.Region, collectPlatform(server.Platform)}]
+		if !ok {
+			pairTs = prevTs
+		}
+		if server.UpdatedAt != pairTs {
+			continue
+		}
+		// the latest rowId of the logical server
+		if prev, ok := previous[serverIdOf(server)]; !ok || prev.UpdatedAt < server.UpdatedAt {
+			previous[serverIdOf(server)] = server
+		}
+	}
+
+	var events []repo.LobbyServerEvent
+	current := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		id := serverIdOf(server)
+		current[id] = true
+
+		prev, ok := previous[id]
+		switch {
+		case !ok:
+			events = append(events, newServerEvent(repo.EventAppeared, ts, server))
+		case prev.RowId != server.RowId:
+			event := newServerEvent(repo.EventRestarted, ts, server)
+			event.PrevRowId = prev.RowId
+			events = append(events, event)
+		}
+	}
+
+	failed := make(map[[2]string]bool)
+	for _, item := range report.Items {
+		if item.Error != "" {
+			failed[[2]string{item.Region, item.Platform}] = true
+		}
+	}
+
+	for id, server := range previous {
+		if current[id] || failed[[2]string{server.Region, collectPlatform(server.Platform)}] {
+			continue
+		}
+		events = append(events, newServerEvent(repo.EventDisappeared, ts, server))
+	}
+
+	// map iteration is random
+	slices.SortStableFunc(events, func(a, b repo.LobbyServerEvent) int {
+		return cmp.Or(cmp.Compare(a.Type, b.Type), cmp.Compare(a.ServerId, b.ServerId))
+	})
+
+	return events
+}
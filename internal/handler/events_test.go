@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"testing"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	psn := lobbyServer("SV_5", "KU_5", lobbyapi.Server{})
+	psn.Platform = lobbyapi.PS4Official
+
+	stale := lobbyServer("SV_6", "KU_6", lobbyapi.Server{})
+	stale.UpdatedAt = 0
+
+	// collected at 0, then the switch pair failed at 1
+	switchServer := func(serverId, rowId string) repo.LobbyServer {
+		server := lobbyServer(serverId, rowId, lobbyapi.Server{})
+		server.Platform = lobbyapi.Switch
+		server.UpdatedAt = 0
+		return server
+	}
+
+	known := []repo.LobbyServer{
+		lobbyServer("SV_1", "KU_1", lobbyapi.Server{}),
+		lobbyServer("SV_2", "KU_2", lobbyapi.Server{}),
+		lobbyServer("SV_3", "KU_3", lobbyapi.Server{}),
+		psn,
+		// absent in the previous snapshot
+		stale,
+		switchServer("SV_8", "KU_8"),
+		switchServer("SV_9", "KU_9"),
+	}
+
+	servers := []repo.LobbyServer{
+		// unchanged
+		lobbyServer("SV_1", "KU_1", lobbyapi.Server{}),
+		// restarted
+		lobbyServer("SV_2", "KU_2a", lobbyapi.Server{}),
+		// came back
+		lobbyServer("SV_6", "KU_6", lobbyapi.Server{}),
+		lobbyServer("SV_7", "KU_7", lobbyapi.Server{}),
+		// the switch pair succeeded again, it is not appeared
+		switchServer("SV_8", "KU_8"),
+	}
+
+	// SV_5 is unknown because PSN failed
+	report := repo.LobbyCollectReport{Items: []repo.LobbyCollectItem{
+		{Region: lobbyapi.ApEast, Platform: lobbyapi.Steam.String()},
+		{Region: lobbyapi.ApEast, Platform: lobbyapi.PSN.String(), Error: "timeout"},
+	}}
+
+	lastSucceeded := map[[2]string]int64{
+		{lobbyapi.ApEast, lobbyapi.Steam.String()}:  1,
+		{lobbyapi.ApEast, lobbyapi.Switch.String()}: 0,
+	}
+
+	events := diffSnapshots(known, servers, report, lastSucceeded, 2)
+	assert.DeepEqual(t, 5, len(events))
+
+	assert.DeepEqual(t, repo.EventAppeared, events[0].Type)
+	assert.DeepEqual(t, "SV_6", events[0].ServerId)
+	assert.DeepEqual(t, repo.EventAppeared, events[1].Type)
+	assert.DeepEqual(t, "SV_7", events[1].ServerId)
+
+	assert.DeepEqual(t, repo.EventDisappeared, events[2].Type)
+	assert.DeepEqual(t, "SV_3", events[2].ServerId)
+
+	// gone since the switch pair last succeeded
+	assert.DeepEqual(t, repo.EventDisappeared, events[3].Type)
+	assert.DeepEqual(t, "SV_9", events[3].ServerId)
+
+	assert.DeepEqual(t, repo.EventRestarted, events[4].Type)
+	assert.DeepEqual(t, "SV_2", events[4].ServerId)
+	assert.DeepEqual(t, "KU_2", events[4].PrevRowId)
+	assert.DeepEqual(t, "KU_2a", events[4].RowId)
+	assert.DeepEqual(t, int64(2), events[4].Ts)
+}
+
+func TestDiffSnapshotsFirst(t *testing.T) {
+	servers := []repo.LobbyServer{lobbyServer("SV_1", "KU_1", lobbyapi.Server{})}
+	assert.DeepEqual(t, 0, len(diffSnapshots(nil, servers, repo.LobbyCollectReport{}, nil, 1)))
+}
@@ -0,0 +1,244 @@
+package handler
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// the weights of identity fields, a known server is linked to the collected one if the score reaches identityThreshold
+const (
+	guidWeight       = 100
+	steamIdWeight    = 60
+	ownerNetIdWeight = 40
+	addressWeight    = 40
+	// the clusters of the same host share it, so it is only counted with one of the fields above
+	hostWeight = 40
+	// multiplied by name similarity
+	nameWeight = 30
+
+	identityThreshold = 60
+	// names less similar than it are not counted
+	minNameSimilarity = 0.8
+)
+
+// newServerId returns the stable server id derived from the first rowId of the server
+func newServerId(region, rowId string) string {
+	sum := sha256.Sum256([]byte(region + "/" + rowId))
+	return "SV_" + hex.EncodeToString(sum[:8])
+}
+
+// serverIdOf returns the stable id of server, the servers recorded before the ids were assigned derive it from rowId
+func serverIdOf(server repo.LobbyServer) string {
+	return cmp.Or(server.ServerId, newServerId(server.Region, server.RowId))
+}
+
+// resolveServerIds assigns stable server ids to the collected servers.
+// Klei assigns a new rowId when the server restarts, so the collected servers with unknown rowIds are linked to
+// the known servers which are absent in this collection by Guid, SteamId, OwnerNetId, Address:Port, host and name similarity.
+// Host and name never link the servers without another identity field, they are shared by the clusters of the same host.
+// The servers that can not be linked get new ids. It returns the number of linked servers.
+func resolveServerIds(servers []repo.LobbyServer, known []repo.LobbyServer) int {
+	idOf := make(map[string]string, len(known))
+	for _, server := range known {
+		idOf[server.RowId] = serverIdOf(server)
+	}
+
+	collected := make(map[string]bool, len(servers))
+	for _, server := range servers {
+		collected[server.RowId] = true
+	}
+
+	// the known servers whose rowIds disappeared, the latest first
+	var candidates []*repo.LobbyServer
+	for i := range known {
+		if !collected[known[i].RowId] {
+			candidates = append(candidates, &known[i])
+		}
+	}
+	slices.SortFunc(candidates, func(a, b *repo.LobbyServer) int {
+		return cmp.Or(cmp.Compare(b.UpdatedAt, a.UpdatedAt), cmp.Compare(a.RowId, b.RowId))
+	})
+
+	// name alone never reaches the threshold, so only the candidates sharing at least one identity field are scored
+	index := make(map[string][]*repo.LobbyServer)
+	for _, candidate := range candidates {
+		for _, key := range identityKeys(*candidate) {
+			index[key] = append(index[key], candidate)
+		}
+	}
+
+	var (
+		linked int
+		used   = make(map[string]bool)
+	)
+
+	// the ids of the collected known rowIds are taken, their old rowIds must not be linked to another server
+	for i := range servers {
+		if id, ok := idOf[servers[i].RowId]; ok {
+			servers[i].ServerId = id
+			used[id] = true
+		}
+	}
+
+	for i := range servers {
+		server := &servers[i]
+		if _, ok := idOf[server.RowId]; ok {
+			continue
+		}
+
+		var (
+			best      *repo.LobbyServer
+			bestScore float64
+		)
+		for _, key := range identityKeys(*server) {
+			for _, candidate := range index[key] {
+				if used[idOf[candidate.RowId]] {
+					continue
+				}
+				score := identityScore(server, candidate)
+				// candidates are sorted, the latest one wins on tie
+				if score >= identityThreshold && (score > bestScore || score == bestScore && candidate.UpdatedAt > best.UpdatedAt) {
+					best, bestScore = candidate, score
+				}
+			}
+		}
+
+		if best == nil {
+			server.ServerId = newServerId(server.Region, server.RowId)
+			continue
+		}
+
+		server.ServerId = idOf[best.RowId]
+		used[server.ServerId] = true
+		linked++
+	}
+
+	return linked
+}
+
+// identityScore returns how likely the two servers are the same one
+func identityScore(a, b *repo.LobbyServer) float64 {
+	// servers never move across regions or platforms
+	if a.Region != b.Region || a.Platform != b.Platform {
+		return 0
+	}
+
+	var score float64
+	if a.Guid != "" && a.Guid == b.Guid {
+		score += guidWeight
+	}
+	if a.SteamId != "" && a.SteamId == b.SteamId {
+		score += steamIdWeight
+	}
+	if a.OwnerNetId != "" && a.OwnerNetId == b.OwnerNetId {
+		score += ownerNetIdWeight
+	}
+	if a.Address != "" && a.Address == b.Address && a.Port == b.Port {
+		score += addressWeight
+	}
+	// host alone is not strong enough
+	if score == 0 {
+		return 0
+	}
+	if a.Host != "" && a.Host == b.Host {
+		score += hostWeight
+	}
+	if similarity := nameSimilarity(a.Name, b.Name); similarity >= minNameSimilarity {
+		score += nameWeight * similarity
+	}
+	return score
+}
+
+// nameSimilarity returns the normalized levenshtein similarity between 0 and 1, case and spaces are ignored.
+// The names with different numbers are not similar at all, such as "1服" and "2服", they are usually different clusters.
+func nameSimilarity(a, b string) float64 {
+	ra, rb := normalizeName(a), normalizeName(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	if !slices.Equal(nameNumbers(ra), nameNumbers(rb)) {
+		return 0
+	}
+	return 1 - float64(levenshtein(ra, rb))/float64(max(len(ra), len(rb)))
+}
+
+// normalizeName lowers the name and removes spaces, the length is limited to 64 runes
+func normalizeName(name string) []rune {
+	var runes []rune
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		runes = append(runes, r)
+		if len(runes) == 64 {
+			break
+		}
+	}
+	return runes
+}
+
+// nameNumbers returns the runs of digits in name
+func nameNumbers(name []rune) []string {
+	var (
+		numbers []string
+		current []rune
+	)
+	for _, r := range append(name, 0) {
+		if unicode.IsDigit(r) {
+			current = append(current, r)
+			continue
+		}
+		if len(current) > 0 {
+			numbers = append(numbers, string(current))
+			current = nil
+		}
+	}
+	return numbers
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// identityKeys returns the non-empty identity fields of server as index keys
+func identityKeys(server repo.LobbyServer) []string {
+	var keys []string
+	if server.Guid != "" {
+		keys = append(keys, "guid:"+server.Guid)
+	}
+	if server.SteamId != "" {
+		keys = append(keys, "steam:"+server.SteamId)
+	}
+	if server.OwnerNetId != "" {
+		keys = append(keys, "owner:"+server.OwnerNetId)
+	}
+	if server.Address != "" {
+		keys = append(keys, "addr:"+server.Address+":"+strconv.Itoa(server.Port))
+	}
+	if server.Host != "" {
+		keys = append(keys, "host:"+server.Host)
+	}
+	return keys
+}
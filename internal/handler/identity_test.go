@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"testing"
+)
+
+func lobbyServer(serverId, rowId string, server lobbyapi.Server) repo.LobbyServer {
+	server.RowId = rowId
+	server.Platform = lobbyapi.Steam
+	return repo.LobbyServer{Region: lobbyapi.ApEast, ServerId: serverId, UpdatedAt: 1, Server: server}
+}
+
+func TestResolveServerIds(t *testing.T) {
+	known := []repo.LobbyServer{
+		lobbyServer("SV_1", "KU_1", lobbyapi.Server{Guid: "g1", Name: "foo"}),
+		lobbyServer("SV_2", "KU_2", lobbyapi.Server{SteamId: "s2", Name: "bar"}),
+		lobbyServer("SV_3", "KU_3", lobbyapi.Server{Host: "KU_host3", Name: "【萌新】饥荒联机 1服"}),
+		lobbyServer("SV_4", "KU_4", lobbyapi.Server{Host: "KU_host4", Name: "baz"}),
+		// assigned before server ids
+		lobbyServer("", "KU_5", lobbyapi.Server{Name: "qux"}),
+		// the old rowId of SV_6 kept until ttl, and the current one
+		lobbyServer("SV_6", "KU_6old", lobbyapi.Server{Host: "KU_host6", Name: "cluster 1"}),
+		lobbyServer("SV_6", "KU_6", lobbyapi.Server{Host: "KU_host6", Name: "cluster 1"}),
+		lobbyServer("SV_7", "KU_7", lobbyapi.Server{Host: "KU_host7", Address: "1.2.3.4", Port: 10999, Name: "qux"}),
+	}
+
+	servers := []repo.LobbyServer{
+		// rowId unchanged
+		lobbyServer("", "KU_5", lobbyapi.Server{Name: "qux"}),
+		// restarted with the same guid
+		lobbyServer("", "KU_1a", lobbyapi.Server{Guid: "g1", Name: "foo renamed"}),
+		// restarted with the same steam id
+		lobbyServer("", "KU_2a", lobbyapi.Server{SteamId: "s2", Name: "bar"}),
+		// another cluster of the same host, the name only differs in number
+		lobbyServer("", "KU_3a", lobbyapi.Server{Host: "KU_host3", Name: "【萌新】饥荒联机 2服"}),
+		// same host but another name
+		lobbyServer("", "KU_4a", lobbyapi.Server{Host: "KU_host4", Name: "another world"}),
+		// rowId unchanged
+		lobbyServer("", "KU_6", lobbyapi.Server{Host: "KU_host6", Name: "cluster 1"}),
+		// another cluster of the same host matches the old rowId of SV_6, which is still live
+		lobbyServer("", "KU_6b", lobbyapi.Server{Host: "KU_host6", Name: "cluster 2"}),
+		// same host and address
+		lobbyServer("", "KU_7a", lobbyapi.Server{Host: "KU_host7", Address: "1.2.3.4", Port: 10999, Name: "quux"}),
+	}
+
+	linked := resolveServerIds(servers, known)
+	assert.DeepEqual(t, 3, linked)
+
+	assert.DeepEqual(t, newServerId(lobbyapi.ApEast, "KU_5"), servers[0].ServerId)
+	assert.DeepEqual(t, "SV_1", servers[1].ServerId)
+	assert.DeepEqual(t, "SV_2", servers[2].ServerId)
+	assert.DeepEqual(t, newServerId(lobbyapi.ApEast, "KU_3a"), servers[3].ServerId)
+	assert.DeepEqual(t, newServerId(lobbyapi.ApEast, "KU_4a"), servers[4].ServerId)
+	assert.DeepEqual(t, "SV_6", servers[5].ServerId)
+	assert.DeepEqual(t, newServerId(lobbyapi.ApEast, "KU_6b"), servers[6].ServerId)
+	assert.DeepEqual(t, "SV_7", servers[7].ServerId)
+}
+
+func TestResolveServerIdsOnce(t *testing.T) {
+	known := []repo.LobbyServer{
+		lobbyServer("SV_1", "KU_1", lobbyapi.Server{Guid: "g1"}),
+	}
+
+	// only one of them could be linked
+	servers := []repo.LobbyServer{
+		lobbyServer("", "KU_1a", lobbyapi.Server{Guid: "g1"}),
+		lobbyServer("", "KU_1b", lobbyapi.Server{Guid: "g1"}),
+	}
+
+	assert.DeepEqual(t, 1, resolveServerIds(servers, known))
+	assert.DeepEqual(t, "SV_1", servers[0].ServerId)
+	assert.DeepEqual(t, newServerId(lobbyapi.ApEast, "KU_1b"), servers[1].ServerId)
+}
+
+func TestNameSimilarity(t *testing.T) {
+	assert.DeepEqual(t, 1.0, nameSimilarity("Foo Bar", "foobar"))
+	assert.DeepEqual(t, 0.0, nameSimilarity("", "foo"))
+	assert.DeepEqual(t, 0.0, nameSimilarity("【萌新】饥荒联机 1服", "【萌新】饥荒联机 2服"))
+	assert.DeepEqual(t, 0.0, nameSimilarity("cluster 1", "cluster 12"))
+	assert.True(t, nameSimilarity("【萌新】饥荒联机 1服", "【萌新】饥荒联机 1服!") >= minNameSimilarity)
+	assert.True(t, nameSimilarity("foo", "another world") < minNameSimilarity)
+}
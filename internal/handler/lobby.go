@@ -4,13 +4,16 @@ import (
 	"cmp"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/dstgo/tracker/internal/data/repo"
 	"github.com/dstgo/tracker/internal/types"
 	"github.com/dstgo/tracker/pkg/lobbyapi"
 	"github.com/oschwald/geoip2-golang"
+	"github.com/qiniu/qmgo"
 	"go.mongodb.org/mongo-driver/bson"
 	"golang.org/x/sync/errgroup"
 	"log/slog"
+	"math"
 	"net"
 	"slices"
 	"strings"
@@ -21,26 +24,48 @@ import (
 type LobbyHandler interface {
 	// GetServersByPage returns server list from database by given queryOptions
 	GetServersByPage(ctx context.Context, queryOptions types.QueryLobbyServersOptions) (types.PageResult[types.QueryLobbyServersResp], error)
-	// ClearExpiredServers remove expired servers from database
+	// ClearExpiredServers removes the servers which have not been seen for ttl, and the history older than ttl
 	ClearExpiredServers(ctx context.Context, ttl time.Duration) (int64, int64, error)
 	// GetServerDetails returns details information for specific server
-	GetServerDetails(ctx context.Context, region, rowId string) (types.QueryLobbyServerDetailResp, error)
+	GetServerDetails(ctx context.Context, server types.QueryLobbyServerDetailsOption) (types.QueryLobbyServerDetailResp, error)
+	// GetServerDetailsBatch returns details information for many servers, failed items carry their own error
+	GetServerDetailsBatch(ctx context.Context, servers []types.QueryLobbyServerDetailsOption) ([]types.QueryLobbyServerDetailBatchItem, error)
+	// GetServerHistory returns the downsampled time series of server between from and to, the server is specified by rowId or serverId
+	GetServerHistory(ctx context.Context, rowId, serverId string, from, to int64, step time.Duration) (types.QueryLobbyHistoryResp, error)
 	// GetStatisticInfo returns statistics information for specific period
 	GetStatisticInfo(ctx context.Context, before, until, tail int64, duration time.Duration) ([]repo.LobbyStatisticInfo, error)
-
-	// GetAllServersFromLobby collects and returns server information from klei lobby server
-	GetAllServersFromLobby(ctx context.Context, limit int, ts int64) ([]repo.LobbyServer, error)
-	// SyncLocalServers collects server information from klei, process and store them into database,
-	// then return how many records has been stored
-	SyncLocalServers(ctx context.Context, limit int) (int, error)
+	// GetCharacterStatistic returns the time series of character distribution of crawled players
+	GetCharacterStatistic(ctx context.Context, options types.QueryLobbyCharacterOption, step time.Duration) ([]types.LobbyCharacterPoint, error)
+	// GetCollectReports returns collection reports for specific period
+	GetCollectReports(ctx context.Context, before, until, tail int64) ([]repo.LobbyCollectReport, error)
+	// GetEvents returns the lifecycle events of servers by page, the latest first
+	GetEvents(ctx context.Context, options types.QueryLobbyEventsOption) (types.PageResult[repo.LobbyServerEvent], error)
+
+	// GetAllServersFromLobby collects and returns server information from klei lobby server,
+	// with the outcome of each region-platform pair
+	GetAllServersFromLobby(ctx context.Context, limit int, ts int64) ([]repo.LobbyServer, repo.LobbyCollectReport, error)
+	// SyncLocalServers collects server information from klei, process and store them into database
+	// with the lifecycle events since the previous snapshot, then return the collection report
+	SyncLocalServers(ctx context.Context, limit int) (repo.LobbyCollectReport, error)
+	// CrawlServerDetails crawls details for at most budget servers of the latest snapshot,
+	// the servers with more online players take precedence, then return how many details stored and failed.
+	// The servers whose day counter went back are recorded as wiped, the online players are recorded as sightings
+	// and character statistics, and the enabled workshop mods are recorded as mod usages and mapped to servers.
+	CrawlServerDetails(ctx context.Context, concurrency, budget int) (int, int, error)
 }
 
-func NewLobbyMongoHandler(lobbyRepo *repo.LobbyRepo, statisticRepo *repo.LobbyStatisticRepo, lobby *lobbyapi.Client, geoip *geoip2.Reader) *LobbyMongoHandler {
+func NewLobbyMongoHandler(lobbyRepo *repo.LobbyRepo, statisticRepo *repo.LobbyStatisticRepo, collectRepo *repo.LobbyCollectRepo,
+	detailsRepo *repo.LobbyDetailsRepo, eventRepo *repo.LobbyEventRepo, playerRepo *repo.PlayerRepo, modRepo *repo.ModRepo, lobby *lobbyapi.Client, geoip *geoip2.Reader) *LobbyMongoHandler {
 	return &LobbyMongoHandler{
 		lobbyRepo:     lobbyRepo,
 		lobby:         lobby,
 		geoip:         geoip,
 		statisticRepo: statisticRepo,
+		collectRepo:   collectRepo,
+		detailsRepo:   detailsRepo,
+		eventRepo:     eventRepo,
+		playerRepo:    playerRepo,
+		modRepo:       modRepo,
 	}
 }
 
@@ -49,18 +74,152 @@ var _ LobbyHandler = (*LobbyMongoHandler)(nil)
 type LobbyMongoHandler struct {
 	lobbyRepo     *repo.LobbyRepo
 	statisticRepo *repo.LobbyStatisticRepo
+	collectRepo   *repo.LobbyCollectRepo
+	detailsRepo   *repo.LobbyDetailsRepo
+	eventRepo     *repo.LobbyEventRepo
+	playerRepo    *repo.PlayerRepo
+	modRepo       *repo.ModRepo
 	lobby         *lobbyapi.Client
 	geoip         *geoip2.Reader
 }
 
 func (l *LobbyMongoHandler) GetServersByPage(ctx context.Context, options types.QueryLobbyServersOptions) (types.PageResult[types.QueryLobbyServersResp], error) {
-	queryM := map[string]any{}
+	var pageResult types.PageResult[types.QueryLobbyServersResp]
+
+	sort := options.Sort
+	// the most relevant first by default when searching
+	if sort == "" && options.Name != "" {
+		sort = "-relevance"
+	}
+
+	sorts, err := parseServersSort(sort)
+	if err != nil {
+		return pageResult, err
+	}
+
+	if options.ModsMatch != "" && options.ModsMatch != modsMatchAny && options.ModsMatch != modsMatchAll {
+		return pageResult, fmt.Errorf("%w: %q", ErrInvalidModsMatch, options.ModsMatch)
+	}
+
+	if options.Name == "" && slices.ContainsFunc(sorts, func(s repo.SortField) bool { return s.Field == repo.ScoreField }) {
+		return pageResult, fmt.Errorf("%w: relevance is only available when searching by name", ErrInvalidSort)
+	}
+
+	result, err := l.lobbyRepo.FindServers(ctx, repo.LobbyServersQuery{
+		Page:   options.Page,
+		Size:   options.Size,
+		Sorts:  sorts,
+		Filter: serversFilter(options),
+		Search: options.Name,
+		Cursor: options.Cursor,
+	})
+	if err != nil {
+		return pageResult, err
+	}
+	pageResult.Total = result.Total
+	pageResult.List = lobbyRepo2Resp(result.List)
+	pageResult.Next = result.Next
+	pageResult.Prev = result.Prev
+
+	return pageResult, nil
+}
 
-	if options.Name != "" {
-		queryM["name"] = bson.M{
-			"$regex":   options.Name,
-			"$options": "i",
+// ErrInvalidSort means that the sort expression contains unknown fields
+var ErrInvalidSort = errors.New("invalid sort")
+
+// ErrInvalidModsMatch means that mods_match is neither any nor all
+var ErrInvalidModsMatch = errors.New("invalid mods_match")
+
+// mods_match values
+const (
+	modsMatchAny = "any"
+	modsMatchAll = "all"
+)
+
+// splitList splits the comma separated list, the items are trimmed and the empty ones are dropped
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// serversSortFields maps sortable fields in api to the fields in database
+var serversSortFields = map[string]string{
+	"name":       "name",
+	"online":     "connected",
+	"maxPlayers": "max_connections",
+	"freeSlots":  "free_slots",
+	"version":    "version",
+	"region":     "region",
+	"area":       "area",
+	"platform":   "platform_name",
+	"mode":       "game_mode",
+	"intent":     "intent",
+	"season":     "season",
+	"rowId":      "row_id",
+	// only available when searching by name
+	"relevance": repo.ScoreField,
+}
+
+// parseServersSort parses sort expression like "-online,name", the fields prefixed with "-" are sorted in descending order
+func parseServersSort(sort string) ([]repo.SortField, error) {
+	var sorts []repo.SortField
+	seen := make(map[string]bool)
+
+	for _, key := range strings.Split(sort, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
 		}
+
+		order := 1
+		if name, found := strings.CutPrefix(key, "-"); found {
+			key, order = name, -1
+		} else if name, found := strings.CutPrefix(key, "+"); found {
+			key = name
+		}
+
+		field, ok := serversSortFields[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidSort, key)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("%w: duplicated field %q", ErrInvalidSort, key)
+		}
+		seen[field] = true
+
+		sorts = append(sorts, repo.SortField{Field: field, Order: order})
+	}
+
+	return sorts, nil
+}
+
+// rangeFilter returns the filter that matches values between lower and upper, returns nil if both are nil
+func rangeFilter(lower, upper *int) bson.M {
+	if lower == nil && upper == nil {
+		return nil
+	}
+
+	filter := bson.M{}
+	if lower != nil {
+		filter["$gte"] = *lower
+	}
+	if upper != nil {
+		filter["$lte"] = *upper
+	}
+	return filter
+}
+
+// serversFilter builds mongo filter from query options
+func serversFilter(options types.QueryLobbyServersOptions) bson.M {
+	queryM := bson.M{}
+
+	if options.ServerId != "" {
+		queryM["server_id"] = options.ServerId
 	}
 
 	if options.Address != "" {
@@ -79,16 +238,48 @@ func (l *LobbyMongoHandler) GetServersByPage(ctx context.Context, options types.
 		queryM["game_mode"] = options.GameMode
 	}
 
-	if options.PvpEnabled != 0 {
-		queryM["pvp_enabled"] = options.PvpEnabled > 0
+	if options.Season != "" {
+		queryM["season"] = options.Season
+	}
+
+	if options.Version != 0 {
+		queryM["version"] = options.Version
+	}
+
+	if options.Continent != "" {
+		queryM["continent"] = options.Continent
 	}
 
-	if options.HasPassword != 0 {
-		queryM["has_password"] = options.PvpEnabled > 0
+	if options.City != "" {
+		queryM["city"] = options.City
 	}
 
-	if options.ModEnabled != 0 {
-		queryM["mod_enabled"] = options.ModEnabled > 0
+	if online := rangeFilter(options.OnlineMin, options.OnlineMax); online != nil {
+		queryM["connected"] = online
+	}
+
+	if options.FreeSlots > 0 {
+		queryM["free_slots"] = bson.M{"$gte": options.FreeSlots}
+	}
+
+	// tri-state switches
+	switches := []struct {
+		field string
+		value int
+	}{
+		{"pvp_enabled", options.PvpEnabled},
+		{"has_password", options.HasPassword},
+		{"mod_enabled", options.ModEnabled},
+		{"allow_new_players", options.AllowNewPlayers},
+		{"server_paused", options.ServerPaused},
+		{"friend_only", options.FriendOnly},
+		{"clan_only", options.ClanOnly},
+		{"lan_only", options.LanOnly},
+	}
+	for _, sw := range switches {
+		if sw.value != 0 {
+			queryM[sw.field] = sw.value > 0
+		}
 	}
 
 	// server tags
@@ -98,27 +289,331 @@ func (l *LobbyMongoHandler) GetServersByPage(ctx context.Context, options types.
 		}
 	}
 
-	var pageResult types.PageResult[types.QueryLobbyServersResp]
+	// enabled mods
+	if mods := splitList(options.Mods); len(mods) > 0 {
+		operator := "$in"
+		if options.ModsMatch == modsMatchAll {
+			operator = "$all"
+		}
+		queryM["mod_ids"] = bson.M{
+			operator: mods,
+		}
+	}
 
-	result, err := l.lobbyRepo.FindServers(ctx, options.Page, options.Size, options.Sort, queryM)
-	if err != nil {
-		return pageResult, err
+	// world generation settings
+	worldGens := []struct {
+		field string
+		value string
+	}{
+		{"world_gen.presets", options.WorldPreset},
+		{"world_gen.task_set", options.TaskSet},
+		{"world_gen.world_size", options.WorldSize},
+		{"world_gen.start_location", options.StartLocation},
+		{"world_gen.season_start", options.SeasonStart},
+	}
+	for _, wg := range worldGens {
+		if wg.value != "" {
+			queryM[wg.field] = wg.value
+		}
+	}
+	if options.Caves > 0 {
+		queryM["world_gen.locations"] = "cave"
+	} else if options.Caves < 0 {
+		// the servers never crawled are unknown
+		queryM["world_gen.locations"] = bson.M{"$exists": true, "$ne": "cave"}
 	}
-	pageResult.Total = result.Total
-	pageResult.List = lobbyRepo2Resp(result.List)
 
-	return pageResult, nil
+	// WeGame and Rail share the same platform code, so match display name too
+	if platform, name, ok := lobbyapi.PlatformOf(lobbyapi.PlatformOption(options.Platform)); ok {
+		queryM["platform"] = platform
+		queryM["platform_name"] = name
+	}
+
+	switch lobbyapi.ServerType(options.ServerType) {
+	case lobbyapi.Dedicated:
+		queryM["is_dedicated"] = true
+	case lobbyapi.ClientHosted:
+		queryM["client_hosted"] = true
+	case lobbyapi.SteamGroup:
+		queryM["steam_clan_id"] = bson.M{"$nin": bson.A{"", nil}}
+	}
+
+	return queryM
 }
 
-func (l *LobbyMongoHandler) GetServerDetails(ctx context.Context, region, rowId string) (types.QueryLobbyServerDetailResp, error) {
+func (l *LobbyMongoHandler) GetServerDetails(ctx context.Context, server types.QueryLobbyServerDetailsOption) (types.QueryLobbyServerDetailResp, error) {
 	var result types.QueryLobbyServerDetailResp
 
+	server, err := l.resolveDetailsOption(ctx, server)
+	if err != nil {
+		return result, err
+	}
+
 	// get details
-	details, err := l.lobby.GetServerDetails(region, rowId)
+	details, err := l.lobby.GetServerDetailsWithContext(ctx, server.Region, server.RowId)
+	if err != nil {
+		return result, err
+	}
+
+	result, err = l.processDetails(server.Region, details)
 	if err != nil {
 		return result, err
 	}
 
+	result.ServerId = server.ServerId
+	// the server id is optional in details, ignore the error
+	if result.ServerId == "" {
+		if ids, err := l.lobbyRepo.FindServerIds(ctx, []string{server.RowId}); err == nil {
+			result.ServerId = ids[server.RowId]
+		}
+	}
+
+	return result, nil
+}
+
+// ErrServerRequired means that neither serverId nor rowId with region is specified
+var ErrServerRequired = errors.New("serverId or rowId with region is required")
+
+// ErrInvalidRange means that the time range is reversed
+var ErrInvalidRange = errors.New("from must be before to")
+
+// resolveServer returns the latest document of server specified by rowId or serverId
+func (l *LobbyMongoHandler) resolveServer(ctx context.Context, rowId, serverId string) (repo.LobbyServer, error) {
+	var (
+		server repo.LobbyServer
+		err    error
+	)
+
+	switch {
+	case serverId != "":
+		server, err = l.lobbyRepo.FindServerById(ctx, serverId)
+	case rowId != "":
+		server, err = l.lobbyRepo.FindServer(ctx, rowId)
+	default:
+		return server, ErrServerRequired
+	}
+
+	if errors.Is(err, qmgo.ErrNoSuchDocuments) {
+		return server, fmt.Errorf("%w: %s", lobbyapi.ErrServerNotFound, cmp.Or(serverId, rowId))
+	}
+	return server, err
+}
+
+// resolveDetailsOption fills the current rowId and region of the server specified by serverId
+func (l *LobbyMongoHandler) resolveDetailsOption(ctx context.Context, option types.QueryLobbyServerDetailsOption) (types.QueryLobbyServerDetailsOption, error) {
+	if option.ServerId == "" {
+		if option.RowId == "" || option.Region == "" {
+			return option, ErrServerRequired
+		}
+		return option, nil
+	}
+
+	server, err := l.resolveServer(ctx, "", option.ServerId)
+	if err != nil {
+		return option, err
+	}
+	option.RowId, option.Region = server.RowId, server.Region
+	return option, nil
+}
+
+// MaxHistoryPoints is the max number of points in server history
+const MaxHistoryPoints = 500
+
+func (l *LobbyMongoHandler) GetServerHistory(ctx context.Context, rowId, serverId string, from, to int64, step time.Duration) (types.QueryLobbyHistoryResp, error) {
+	var result types.QueryLobbyHistoryResp
+
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	if from <= 0 {
+		from = to - (24 * time.Hour).Milliseconds()
+	}
+	if from > to {
+		return result, ErrInvalidRange
+	}
+
+	stepMs := max(step.Milliseconds(), time.Minute.Milliseconds())
+	// enlarge step if too many points
+	if points := (to-from)/stepMs + 1; points > MaxHistoryPoints {
+		stepMs = (to-from)/(MaxHistoryPoints-1) + 1
+	}
+
+	server, err := l.resolveServer(ctx, rowId, serverId)
+	if err != nil {
+		return result, err
+	}
+
+	// the history of logical server, across its rowIds
+	histories, err := l.lobbyRepo.FindHistory(ctx, server, to)
+	if err != nil {
+		return result, err
+	}
+
+	type state struct {
+		ts     int64
+		server repo.LobbyServer
+	}
+	var (
+		states []state
+		rowIds = []string{server.RowId}
+	)
+	err = repo.ReplayHistory(histories, func(ts int64, server repo.LobbyServer) error {
+		states = append(states, state{ts, server})
+		if !slices.Contains(rowIds, server.RowId) {
+			rowIds = append(rowIds, server.RowId)
+		}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	days, err := l.detailsRepo.FindDays(ctx, rowIds, from-stepMs, to)
+	if err != nil {
+		return result, err
+	}
+
+	// disappearances are not recorded in history
+	events, err := l.eventRepo.FindServerEvents(ctx, serverIdOf(server), []string{repo.EventAppeared, repo.EventDisappeared}, to)
+	if err != nil {
+		return result, err
+	}
+	offline := offlinePeriods(events)
+
+	result.RowId = server.RowId
+	result.ServerId = server.ServerId
+	result.Name = server.Name
+	result.From, result.To, result.Step = from, to, stepMs
+	result.Points = []types.LobbyHistoryPoint{}
+
+	// sample-and-hold, each point holds the latest state at the end of its step
+	var (
+		current *repo.LobbyServer
+		day     int
+		si, di  int
+	)
+	for ts := from; ts <= to; ts += stepMs {
+		// not seen since last collection
+		if ts > server.UpdatedAt {
+			break
+		}
+
+		end := ts + stepMs
+		peak := 0
+		if current != nil {
+			peak = current.Connected
+		}
+		for ; si < len(states) && states[si].ts < end; si++ {
+			current = &states[si].server
+			peak = max(peak, current.Connected)
+		}
+		for ; di < len(days) && days[di].CreatedAt < end; di++ {
+			day = days[di].Details.Day
+		}
+
+		// not appeared yet, or offline at the end of step
+		if current == nil || isOffline(offline, end-1) {
+			continue
+		}
+
+		result.Points = append(result.Points, types.LobbyHistoryPoint{
+			Ts:         ts,
+			Online:     current.Connected,
+			OnlinePeak: peak,
+			MaxPlayers: current.MaxConnections,
+			Season:     current.Season,
+			Day:        day,
+			Paused:     current.ServerPaused,
+			Version:    current.Version,
+		})
+	}
+
+	return result, nil
+}
+
+// offlinePeriods returns the periods [disappeared, appeared) of server from its appeared and disappeared events in time order,
+// the last one ends with math.MaxInt64 if the server has not appeared again
+func offlinePeriods(events []repo.LobbyServerEvent) [][2]int64 {
+	var periods [][2]int64
+	for _, event := range events {
+		switch open := len(periods) > 0 && periods[len(periods)-1][1] == math.MaxInt64; {
+		case event.Type == repo.EventDisappeared && !open:
+			periods = append(periods, [2]int64{event.Ts, math.MaxInt64})
+		case event.Type == repo.EventAppeared && open:
+			periods[len(periods)-1][1] = event.Ts
+		}
+	}
+	return periods
+}
+
+// isOffline reports whether ts is in any of the offline periods
+func isOffline(periods [][2]int64, ts int64) bool {
+	for _, period := range periods {
+		if ts >= period[0] && ts < period[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxDetailsBatch is the max number of servers in one batch
+const MaxDetailsBatch = 50
+
+// concurrent requests of one batch
+const detailsBatchLimit = 8
+
+func (l *LobbyMongoHandler) GetServerDetailsBatch(ctx context.Context, servers []types.QueryLobbyServerDetailsOption) ([]types.QueryLobbyServerDetailBatchItem, error) {
+	if len(servers) > MaxDetailsBatch {
+		return nil, fmt.Errorf("lobby details: at most %d servers in one batch, got %d", MaxDetailsBatch, len(servers))
+	}
+
+	items := make([]types.QueryLobbyServerDetailBatchItem, len(servers))
+	queries := make([]lobbyapi.DetailsQuery, 0, len(servers))
+	// index of item for each query
+	queryItems := make([]int, 0, len(servers))
+	for i, server := range servers {
+		resolved, err := l.resolveDetailsOption(ctx, server)
+		items[i] = types.QueryLobbyServerDetailBatchItem{RowId: resolved.RowId, Region: resolved.Region, ServerId: resolved.ServerId, Err: err}
+		if err != nil {
+			continue
+		}
+		queries = append(queries, lobbyapi.DetailsQuery{Region: resolved.Region, RowId: resolved.RowId})
+		queryItems = append(queryItems, i)
+	}
+
+	results := l.lobby.GetServerDetailsBatch(ctx, queries, detailsBatchLimit)
+
+	// the server id is optional in details, ignore the error
+	rowIds := make([]string, 0, len(queries))
+	for _, query := range queries {
+		rowIds = append(rowIds, query.RowId)
+	}
+	serverIds, _ := l.lobbyRepo.FindServerIds(ctx, rowIds)
+
+	for i, result := range results {
+		item := &items[queryItems[i]]
+		item.Err = result.Err
+		if item.Err != nil {
+			continue
+		}
+
+		details, err := l.processDetails(result.Region, result.Details)
+		if err != nil {
+			item.Err = err
+			continue
+		}
+		details.ServerId = cmp.Or(item.ServerId, serverIds[result.RowId])
+		item.ServerId = details.ServerId
+		item.Details = &details
+	}
+
+	return items, nil
+}
+
+// processDetails fills the geo information of server details
+func (l *LobbyMongoHandler) processDetails(region string, details lobbyapi.ServerDetails) (types.QueryLobbyServerDetailResp, error) {
+	var result types.QueryLobbyServerDetailResp
+
 	// process
 	processList, err := processLobbyServer([]lobbyapi.Server{details.Server}, l.geoip, region, 0)
 	if err != nil {
@@ -136,20 +631,27 @@ func (l *LobbyMongoHandler) GetServerDetails(ctx context.Context, region, rowId
 	return result, nil
 }
 
-// GetAllServersFromLobby returns all lobby servers in parallel. Using limit params to limit the number of goroutine
-func (l *LobbyMongoHandler) GetAllServersFromLobby(ctx context.Context, limit int, ts int64) ([]repo.LobbyServer, error) {
-	slog.Info("begin")
+// GetAllServersFromLobby returns all lobby servers in parallel. Using limit params to limit the number of goroutine.
+// The failed region-platform pairs will not abort the collection, their outcomes are recorded in the report,
+// error is returned only if the whole collection can not be performed.
+func (l *LobbyMongoHandler) GetAllServersFromLobby(ctx context.Context, limit int, ts int64) ([]repo.LobbyServer, repo.LobbyCollectReport, error) {
+	start := time.Now()
+	report := repo.LobbyCollectReport{Ts: ts}
 
-	regions, err := l.lobby.GetCapableRegions()
+	regions, err := l.lobby.GetCapableRegionsWithContext(ctx)
 	if err != nil {
-		return nil, err
+		report.Error = err.Error()
+		report.Cost = time.Since(start).Milliseconds()
+		return nil, report, err
 	}
 
 	var servers []repo.LobbyServer
-	// protect servers []repo.LobbyServer
+	// protect servers []repo.LobbyServer and report
 	var mu sync.Mutex
 
-	group, _ := errgroup.WithContext(ctx)
+	// goroutines never return error, so a failed pair would not cancel the others,
+	// in-flight requests will be aborted once ctx is done
+	var group errgroup.Group
 	group.SetLimit(limit)
 
 	// request servers list from lobby server for each region and platforms
@@ -157,25 +659,17 @@ func (l *LobbyMongoHandler) GetAllServersFromLobby(ctx context.Context, limit in
 	for _, region := range regions.Regions {
 		for _, platform := range lobbyapi.ExplicitPlatforms {
 			group.Go(func() error {
-				// get servers
-				lobbyServers, err := l.lobby.GetLobbyServers(region.Region, platform)
+				item := repo.LobbyCollectItem{Region: region.Region, Platform: platform}
+				processList, err := l.collectServers(ctx, region.Region, platform, ts, &item)
 				if err != nil {
-					return err
-				}
-
-				// return if list is empty
-				if len(lobbyServers.List) == 0 {
-					return nil
-				}
-
-				// process
-				processList, err := processLobbyServer(lobbyServers.List, l.geoip, region.Region, ts)
-				if err != nil {
-					return err
+					item.Error = err.Error()
+					item.Status = lobbyapi.StatusCodeOf(err)
+					slog.Warn("lobby collect failed", slog.String("region", region.Region), slog.String("platform", platform), slog.Any("err", err))
 				}
 
 				mu.Lock()
 				servers = append(servers, processList...)
+				report.Items = append(report.Items, item)
 				mu.Unlock()
 
 				return nil
@@ -183,18 +677,64 @@ func (l *LobbyMongoHandler) GetAllServersFromLobby(ctx context.Context, limit in
 		}
 	}
 
-	// error occurred
-	if err := group.Wait(); err != nil {
+	_ = group.Wait()
+
+	for _, item := range report.Items {
+		if item.Error != "" {
+			report.Failed++
+		} else {
+			report.Succeeded++
+		}
+	}
+	report.Servers = len(servers)
+	report.Cost = time.Since(start).Milliseconds()
+
+	// keep report items in stable order
+	slices.SortFunc(report.Items, func(a, b repo.LobbyCollectItem) int {
+		return cmp.Or(cmp.Compare(a.Region, b.Region), cmp.Compare(a.Platform, b.Platform))
+	})
+
+	return servers, report, nil
+}
+
+// collectServers collects servers of single region-platform pair, and records the outcome into item
+func (l *LobbyMongoHandler) collectServers(ctx context.Context, region, platform string, ts int64, item *repo.LobbyCollectItem) ([]repo.LobbyServer, error) {
+	start := time.Now()
+	defer func() {
+		item.Latency = time.Since(start).Milliseconds()
+	}()
+
+	// no need to send request if collection has been canceled
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 
-	return servers, nil
+	// get servers
+	lobbyServers, err := l.lobby.GetLobbyServersWithContext(ctx, region, platform)
+	if err != nil {
+		return nil, err
+	}
+
+	// return if list is empty
+	if len(lobbyServers.List) == 0 {
+		return nil, nil
+	}
+
+	// process
+	processList, err := processLobbyServer(lobbyServers.List, l.geoip, region, ts)
+	if err != nil {
+		return nil, err
+	}
+	item.Servers = len(processList)
+
+	return processList, nil
 }
 
 func (l *LobbyMongoHandler) ClearExpiredServers(ctx context.Context, ttl time.Duration) (int64, int64, error) {
 	expiredTs := time.Now().Add(-ttl).UnixMilli()
+	// the servers have not been seen since expiredTs
 	filter := bson.M{
-		"created_at": bson.M{
+		"updated_at": bson.M{
 			"$lte": expiredTs,
 		},
 	}
@@ -203,31 +743,288 @@ func (l *LobbyMongoHandler) ClearExpiredServers(ctx context.Context, ttl time.Du
 	if err != nil {
 		return 0, 0, err
 	}
+
+	// history, reports, details, events, sightings and mod usages live as long as servers
+	if _, err := l.lobbyRepo.RemoveHistoryBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.collectRepo.RemoveBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.detailsRepo.RemoveBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.eventRepo.RemoveBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.playerRepo.RemoveBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
+	if _, err := l.modRepo.RemoveBefore(ctx, expiredTs); err != nil {
+		return 0, 0, err
+	}
 	return deleted, total, nil
 }
 
-func (l *LobbyMongoHandler) SyncLocalServers(ctx context.Context, limit int) (int, error) {
+func (l *LobbyMongoHandler) SyncLocalServers(ctx context.Context, limit int) (repo.LobbyCollectReport, error) {
 
 	// round zero time
 	ts := time.Now().Round(time.Minute).UnixMilli()
 
-	servers, err := l.GetAllServersFromLobby(ctx, limit, ts)
+	servers, report, err := l.GetAllServersFromLobby(ctx, limit, ts)
+
+	// report is always stored, even if the collection failed, use a fresh context
+	// because ctx may have been canceled already
+	defer func() {
+		if err := l.collectRepo.InsertOne(context.WithoutCancel(ctx), report); err != nil {
+			slog.Error("failed to store lobby collect report", slog.Any("err", err))
+		}
+	}()
+
 	if err != nil {
-		return 0, err
+		return report, err
 	}
 
-	// store the server information into mongodb
-	inserted, err := l.lobbyRepo.InsertManyServers(ctx, servers)
+	// nothing collected
+	if len(servers) == 0 {
+		return report, errors.New("lobby collect: no servers collected")
+	}
+
+	// link the new rowIds to known servers
+	known, err := l.lobbyRepo.FindIdentities(ctx, servers)
+	if err != nil {
+		return report, err
+	}
+	if linked := resolveServerIds(servers, known); linked > 0 {
+		slog.Debug("lobby servers linked", slog.Int("linked", linked))
+	}
+
+	// diff with the previous snapshots before they are overwritten
+	lastSucceeded, err := l.collectRepo.LastSucceeded(ctx)
+	if err != nil {
+		return report, err
+	}
+	latestTs, err := l.lobbyRepo.LatestTs(ctx)
 	if err != nil {
-		return inserted, err
+		return report, err
+	}
+	snapshotTs := []int64{latestTs}
+	for _, pairTs := range lastSucceeded {
+		snapshotTs = append(snapshotTs, pairTs)
+	}
+	previous, err := l.lobbyRepo.FindSnapshots(ctx, snapshotTs)
+	if err != nil {
+		return report, err
+	}
+	events := diffSnapshots(previous, servers, report, lastSucceeded, ts)
+
+	// update the current servers and record changes into mongodb
+	if _, err := l.lobbyRepo.UpsertServers(ctx, ts, servers); err != nil {
+		return report, err
+	}
+
+	if _, err := l.eventRepo.InsertMany(ctx, events); err != nil {
+		return report, err
 	}
 
 	// statistic server information
 	if err := l.StatisticServers(ctx, ts, servers); err != nil {
-		return 0, err
+		return report, err
 	}
 
-	return inserted, nil
+	return report, nil
+}
+
+func (l *LobbyMongoHandler) CrawlServerDetails(ctx context.Context, concurrency, budget int) (int, int, error) {
+	ts, err := l.lobbyRepo.LatestTs(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// no snapshot yet
+	if ts == 0 {
+		return 0, 0, nil
+	}
+
+	// prioritise by online players
+	servers, err := l.lobbyRepo.FindTopServers(ctx, ts, int64(budget))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	queries := make([]lobbyapi.DetailsQuery, 0, len(servers))
+	for _, server := range servers {
+		queries = append(queries, lobbyapi.DetailsQuery{Region: server.Region, RowId: server.RowId})
+	}
+
+	results := l.lobby.GetServerDetailsBatch(ctx, queries, concurrency)
+
+	crawledAt := time.Now().UnixMilli()
+	var (
+		details []repo.LobbyServerDetails
+		failed  int
+	)
+	for i, result := range results {
+		if result.Err != nil {
+			failed++
+			slog.Debug("crawl details failed", slog.String("region", result.Region), slog.String("rowId", result.RowId), slog.Any("err", result.Err))
+			continue
+		}
+		details = append(details, repo.LobbyServerDetails{
+			Region:        servers[i].Region,
+			Area:          servers[i].Area,
+			ServerId:      serverIdOf(servers[i]),
+			SnapshotTs:    ts,
+			CreatedAt:     crawledAt,
+			ServerDetails: result.Details,
+		})
+	}
+
+	if len(details) == 0 {
+		return 0, failed, nil
+	}
+
+	// compare with the previous crawls before storing the new ones
+	events, err := l.wipedEvents(ctx, details, crawledAt)
+	if err != nil {
+		return 0, failed, err
+	}
+
+	// store what have been crawled even if ctx is done
+	stored, err := l.detailsRepo.InsertMany(context.WithoutCancel(ctx), details)
+	if err != nil {
+		return 0, failed, err
+	}
+
+	if _, err := l.eventRepo.InsertMany(context.WithoutCancel(ctx), events); err != nil {
+		return stored, failed, err
+	}
+
+	sightings := playerSightings(details)
+	if _, err := l.playerRepo.UpsertSightings(context.WithoutCancel(ctx), crawledAt, playerSightingGap.Milliseconds(), sightings); err != nil {
+		return stored, failed, err
+	}
+
+	// keyed by the crawl time, the snapshot could be the same across crawls if the collection is failing
+	if err := l.StatisticCharacters(context.WithoutCancel(ctx), crawledAt, details); err != nil {
+		return stored, failed, err
+	}
+	if _, err := l.modRepo.InsertUsages(context.WithoutCancel(ctx), modUsages(crawledAt, details)); err != nil {
+		return stored, failed, err
+	}
+	if err := l.lobbyRepo.UpdateModIds(context.WithoutCancel(ctx), serverModIds(details)); err != nil {
+		return stored, failed, err
+	}
+	if err := l.lobbyRepo.UpdateWorldGens(context.WithoutCancel(ctx), serverWorldGens(details)); err != nil {
+		return stored, failed, err
+	}
+
+	return stored, failed, nil
+}
+
+// serverWorldGens returns the world generation summary of the crawled servers keyed by rowId,
+// the servers without worldgen are ignored
+func serverWorldGens(details []repo.LobbyServerDetails) map[string]repo.LobbyWorldGen {
+	worldGens := make(map[string]repo.LobbyWorldGen, len(details))
+	for _, detail := range details {
+		shards := detail.Details.WorldGen.Shards
+		if len(shards) == 0 {
+			continue
+		}
+
+		var worldGen repo.LobbyWorldGen
+		for _, shard := range shards {
+			if shard.Preset != "" && !slices.Contains(worldGen.Presets, shard.Preset) {
+				worldGen.Presets = append(worldGen.Presets, shard.Preset)
+			}
+			if shard.Location != "" && !slices.Contains(worldGen.Locations, shard.Location) {
+				worldGen.Locations = append(worldGen.Locations, shard.Location)
+			}
+		}
+
+		master, ok := detail.Details.WorldGen.Shard("forest")
+		if !ok {
+			master = shards[0]
+		}
+		worldGen.TaskSet = master.TaskSet
+		worldGen.WorldSize = master.WorldSize
+		worldGen.StartLocation = master.StartLocation
+		worldGen.SeasonStart = master.SeasonStart
+
+		worldGens[detail.RowId] = worldGen
+	}
+	return worldGens
+}
+
+// wipedEvents returns the events of the servers whose day counter is less than the one of previous crawl
+func (l *LobbyMongoHandler) wipedEvents(ctx context.Context, details []repo.LobbyServerDetails, ts int64) ([]repo.LobbyServerEvent, error) {
+	serverIds := make([]string, 0, len(details))
+	for _, detail := range details {
+		serverIds = append(serverIds, detail.ServerId)
+	}
+
+	days, err := l.detailsRepo.FindLatestDays(ctx, serverIds, ts)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []repo.LobbyServerEvent
+	for _, detail := range details {
+		prevDay, ok := days[detail.ServerId]
+		if !ok || detail.Details.Day >= prevDay {
+			continue
+		}
+		events = append(events, repo.LobbyServerEvent{
+			Type:         repo.EventWiped,
+			Ts:           ts,
+			ServerId:     detail.ServerId,
+			RowId:        detail.RowId,
+			Region:       detail.Region,
+			PlatformName: lobbyapi.PlatformDisplayName(detail.Region, detail.Platform),
+			Name:         detail.Name,
+			Day:          detail.Details.Day,
+			PrevDay:      prevDay,
+		})
+	}
+	return events, nil
+}
+
+// GetEvents returns the lifecycle events of servers by page, the latest first
+func (l *LobbyMongoHandler) GetEvents(ctx context.Context, options types.QueryLobbyEventsOption) (types.PageResult[repo.LobbyServerEvent], error) {
+	var eventTypes []string
+	if options.Type != "" {
+		for _, typ := range strings.Split(options.Type, ",") {
+			switch typ = strings.TrimSpace(typ); typ {
+			case repo.EventAppeared, repo.EventDisappeared, repo.EventRestarted, repo.EventWiped:
+				eventTypes = append(eventTypes, typ)
+			default:
+				return types.PageResult[repo.LobbyServerEvent]{}, fmt.Errorf("%w: %q", ErrInvalidEventType, typ)
+			}
+		}
+	}
+
+	return l.eventRepo.FindEvents(ctx, repo.LobbyEventsQuery{
+		Page:     options.Page,
+		Size:     options.Size,
+		ServerId: options.ServerId,
+		Region:   options.Region,
+		Types:    eventTypes,
+		From:     options.From,
+		To:       options.To,
+	})
+}
+
+// GetCollectReports returns the latest collection reports for specific period
+func (l *LobbyMongoHandler) GetCollectReports(ctx context.Context, before, until, tail int64) ([]repo.LobbyCollectReport, error) {
+	if until <= 0 {
+		until = time.Now().UnixMilli()
+	}
+
+	reports, err := l.collectRepo.GetMany(ctx, before, until, tail)
+	if err != nil {
+		return []repo.LobbyCollectReport{}, err
+	}
+	return reports, nil
 }
 
 func (l *LobbyMongoHandler) GetStatisticInfo(ctx context.Context, before, until, tail int64, duration time.Duration) ([]repo.LobbyStatisticInfo, error) {
@@ -246,6 +1043,67 @@ func (l *LobbyMongoHandler) GetStatisticInfo(ctx context.Context, before, until,
 	return statisticInfos, err
 }
 
+// GetCharacterStatistic returns the time series of character distribution, the picks are averaged by crawls in each step
+func (l *LobbyMongoHandler) GetCharacterStatistic(ctx context.Context, options types.QueryLobbyCharacterOption, step time.Duration) ([]types.LobbyCharacterPoint, error) {
+	to, from := options.To, options.From
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	if from <= 0 {
+		from = to - (7 * 24 * time.Hour).Milliseconds()
+	}
+	if from > to {
+		return nil, ErrInvalidRange
+	}
+
+	stepMs := max(step.Milliseconds(), time.Minute.Milliseconds())
+	// enlarge step if too many points
+	if points := (to-from)/stepMs + 1; points > MaxHistoryPoints {
+		stepMs = (to-from)/(MaxHistoryPoints-1) + 1
+	}
+
+	query := repo.LobbyCharactersQuery{
+		Region:   options.Region,
+		GameMode: options.GameMode,
+		From:     from,
+		To:       to,
+		Step:     stepMs,
+	}
+	if _, name, ok := lobbyapi.PlatformOf(lobbyapi.PlatformOption(options.Platform)); ok {
+		query.PlatformName = name
+	}
+
+	buckets, err := l.statisticRepo.GetCharacters(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	points := make([]types.LobbyCharacterPoint, 0, len(buckets))
+	for _, bucket := range buckets {
+		samples := float64(max(bucket.Samples, 1))
+
+		var picks int64
+		for _, item := range bucket.Characters {
+			picks += item.OnlinePlayers
+		}
+
+		point := types.LobbyCharacterPoint{Ts: bucket.Ts, Players: float64(picks) / samples}
+		for _, item := range bucket.Characters {
+			point.Characters = append(point.Characters, types.LobbyCharacterItem{
+				Prefab:  item.Label,
+				Players: float64(item.OnlinePlayers) / samples,
+				Ratio:   float64(item.OnlinePlayers) / float64(max(picks, 1)),
+			})
+		}
+		slices.SortFunc(point.Characters, func(a, b types.LobbyCharacterItem) int {
+			return cmp.Or(-cmp.Compare(a.Players, b.Players), cmp.Compare(a.Prefab, b.Prefab))
+		})
+
+		points = append(points, point)
+	}
+	return points, nil
+}
+
 func (l *LobbyMongoHandler) StatisticServers(ctx context.Context, ts int64, servers []repo.LobbyServer) error {
 
 	statistic := repo.LobbyStatisticInfo{
@@ -296,11 +1154,78 @@ func (l *LobbyMongoHandler) StatisticServers(ctx context.Context, ts int64, serv
 	return l.statisticRepo.InsertOne(ctx, statistic)
 }
 
+// StatisticCharacters stores the character picks of the players crawled at ts, grouped by region, platform and game mode
+func (l *LobbyMongoHandler) StatisticCharacters(ctx context.Context, ts int64, details []repo.LobbyServerDetails) error {
+	return l.statisticRepo.InsertCharacters(ctx, characterStatistics(ts, details))
+}
+
+// characterStatistics groups the character picks of players by region, platform and game mode,
+// the players who are still selecting character are ignored
+func characterStatistics(ts int64, details []repo.LobbyServerDetails) []repo.LobbyCharacterStatistic {
+	type group struct {
+		region, platform, mode string
+	}
+
+	var (
+		groups     []group
+		statistics = make(map[group]*repo.LobbyCharacterStatistic)
+		characters = make(map[group]map[string]repo.LobbyStatisticItem)
+	)
+
+	for _, detail := range details {
+		key := group{detail.Region, lobbyapi.PlatformDisplayName(detail.Region, detail.Platform), detail.GameMode}
+		statistic, ok := statistics[key]
+		if !ok {
+			statistic = &repo.LobbyCharacterStatistic{Ts: ts, Region: key.region, PlatformName: key.platform, GameMode: key.mode}
+			statistics[key] = statistic
+			characters[key] = make(map[string]repo.LobbyStatisticItem)
+			groups = append(groups, key)
+		}
+
+		// count the server once for each character
+		picked := make(map[string]bool)
+		for _, player := range detail.Details.Players {
+			if player.Prefab == "" {
+				continue
+			}
+			statistic.Players++
+
+			item := characters[key][player.Prefab]
+			item.OnlinePlayers++
+			if !picked[player.Prefab] {
+				item.TotalServers++
+				picked[player.Prefab] = true
+			}
+			characters[key][player.Prefab] = item
+		}
+	}
+
+	var result []repo.LobbyCharacterStatistic
+	for _, key := range groups {
+		statistic := statistics[key]
+		if statistic.Players == 0 {
+			continue
+		}
+
+		for label, item := range characters[key] {
+			item.Label = label
+			statistic.Characters = append(statistic.Characters, item)
+		}
+		slices.SortFunc(statistic.Characters, func(a, b repo.LobbyStatisticItem) int {
+			return cmp.Or(-cmp.Compare(a.OnlinePlayers, b.OnlinePlayers), cmp.Compare(a.Label, b.Label))
+		})
+
+		result = append(result, *statistic)
+	}
+	return result
+}
+
 func lobbyRepo2Resp(servers []repo.LobbyServer) []types.QueryLobbyServersResp {
 	var res []types.QueryLobbyServersResp
 	for _, server := range servers {
 		res = append(res, types.QueryLobbyServersResp{
 			RowId:        server.RowId,
+			ServerId:     server.ServerId,
 			SteamClanId:  server.SteamClanId,
 			Address:      server.Address,
 			Port:         server.Port,
@@ -318,6 +1243,7 @@ func lobbyRepo2Resp(servers []repo.LobbyServer) []types.QueryLobbyServersResp {
 			Season:       server.Season,
 			// convert tags into array
 			Tags:            server.TagNames,
+			ModIds:          server.ModIds,
 			MaxPlayers:      server.MaxConnections,
 			Online:          server.Connected,
 			Mod:             server.ModEnabled,
@@ -338,7 +1264,8 @@ func processLobbyServer(servers []lobbyapi.Server, geoip *geoip2.Reader, region
 	var ans []repo.LobbyServer
 	for _, server := range servers {
 
-		s := repo.LobbyServer{Region: region, Server: server, CreatedAt: ts}
+		s := repo.LobbyServer{Region: region, Server: server, CreatedAt: ts, UpdatedAt: ts}
+		s.FreeSlots = max(s.MaxConnections-s.Connected, 0)
 
 		// tags
 		if s.Tags != "" {
@@ -358,7 +1285,7 @@ func processLobbyServer(servers []lobbyapi.Server, geoip *geoip2.Reader, region
 		// display platform
 		s.PlatformName = lobbyapi.PlatformDisplayName(s.Region, s.Platform)
 
-		if s.PlatformName == "WeGame" {
+		if s.PlatformName == lobbyapi.WeGame {
 			s.Area = "CN"
 		}
 
@@ -2,11 +2,18 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
 	"github.com/dstgo/tracker/internal/assets"
 	"github.com/dstgo/tracker/internal/data"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/internal/types"
 	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"github.com/dstgo/tracker/pkg/lobbyapi/lobbytest"
 	"github.com/go-resty/resty/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"math"
+	"net/http"
 	"testing"
 )
 
@@ -14,16 +21,43 @@ func TestLobbyMongoHandler_GetAllLobbyServers(t *testing.T) {
 	geoip, err := data.LoadGeoIpDBInMem(assets.GeopIp2CityDB)
 	assert.Nil(t, err)
 
-	client := lobbyapi.New("")
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
 
-	handler := LobbyMongoHandler{geoip: geoip, lobby: client}
+	handler := LobbyMongoHandler{geoip: geoip, lobby: lobby.Client("")}
 
-	servers, err := handler.GetAllServersFromLobby(context.Background(), 30, 0)
+	servers, report, err := handler.GetAllServersFromLobby(context.Background(), 30, 0)
 	assert.Nil(t, err)
+	assert.DeepEqual(t, 4, len(servers))
+	assert.DeepEqual(t, 20, report.Succeeded)
 
 	t.Log(len(servers))
 }
 
+func TestLobbyMongoHandler_GetAllLobbyServersPartial(t *testing.T) {
+	geoip, err := data.LoadGeoIpDBInMem(assets.GeopIp2CityDB)
+	assert.Nil(t, err)
+
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+	lobby.SetStatus("/ap-east-1-Rail.json.gz", http.StatusServiceUnavailable)
+
+	handler := LobbyMongoHandler{geoip: geoip, lobby: lobby.Client("")}
+
+	servers, report, err := handler.GetAllServersFromLobby(context.Background(), 30, 0)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 3, len(servers))
+	assert.DeepEqual(t, 3, report.Servers)
+	assert.DeepEqual(t, 1, report.Failed)
+
+	for _, item := range report.Items {
+		if item.Region == "ap-east-1" && item.Platform == "Rail" {
+			assert.DeepEqual(t, http.StatusServiceUnavailable, item.Status)
+			assert.True(t, item.Error != "")
+		}
+	}
+}
+
 func TestLobbyMongoHandler_GetAllLobbyServersWithProxy(t *testing.T) {
 	geoip, err := data.LoadGeoIpDBInMem(assets.GeopIp2CityDB)
 	assert.Nil(t, err)
@@ -34,8 +68,202 @@ func TestLobbyMongoHandler_GetAllLobbyServersWithProxy(t *testing.T) {
 
 	handler := LobbyMongoHandler{geoip: geoip, lobby: client}
 
-	servers, err := handler.GetAllServersFromLobby(context.Background(), 30, 0)
+	servers, _, err := handler.GetAllServersFromLobby(context.Background(), 30, 0)
 	assert.Nil(t, err)
 
 	t.Log(len(servers))
 }
+
+func TestServersFilterPlatform(t *testing.T) {
+	samples := []struct {
+		platform     int
+		code         any
+		platformName any
+	}{
+		{0, nil, nil},
+		{1, lobbyapi.Steam, "Steam"},
+		{2, lobbyapi.Rail, lobbyapi.WeGame},
+		{3, lobbyapi.PSN, "PSN"},
+		{4, lobbyapi.XBOne, "XBone"},
+		{5, lobbyapi.PS4Official, "PS4Official"},
+		{6, lobbyapi.Switch, "Switch"},
+	}
+
+	for _, sample := range samples {
+		filter := serversFilter(types.QueryLobbyServersOptions{Platform: sample.platform})
+		assert.DeepEqual(t, sample.code, filter["platform"])
+		assert.DeepEqual(t, sample.platformName, filter["platform_name"])
+	}
+}
+
+func TestServersFilterMods(t *testing.T) {
+	filter := serversFilter(types.QueryLobbyServersOptions{Mods: "374550642,378160973"})
+	assert.DeepEqual(t, bson.M{"mod_ids": bson.M{"$in": []string{"374550642", "378160973"}}}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{Mods: "374550642,378160973", ModsMatch: "all"})
+	assert.DeepEqual(t, bson.M{"mod_ids": bson.M{"$all": []string{"374550642", "378160973"}}}, filter)
+
+	// spaces and empty items
+	filter = serversFilter(types.QueryLobbyServersOptions{Mods: "374550642, 378160973,"})
+	assert.DeepEqual(t, bson.M{"mod_ids": bson.M{"$in": []string{"374550642", "378160973"}}}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{Mods: " , "})
+	assert.DeepEqual(t, bson.M{}, filter)
+}
+
+func TestServersFilterWorldGen(t *testing.T) {
+	filter := serversFilter(types.QueryLobbyServersOptions{WorldPreset: "LIGHTS_OUT", WorldSize: "huge", Caves: 1})
+	assert.DeepEqual(t, bson.M{
+		"world_gen.presets":    "LIGHTS_OUT",
+		"world_gen.world_size": "huge",
+		"world_gen.locations":  "cave",
+	}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{SeasonStart: "winter", Caves: -1})
+	assert.DeepEqual(t, bson.M{
+		"world_gen.season_start": "winter",
+		"world_gen.locations":    bson.M{"$exists": true, "$ne": "cave"},
+	}, filter)
+}
+
+func TestServerWorldGens(t *testing.T) {
+	withCaves := repo.LobbyServerDetails{ServerDetails: lobbyapi.ServerDetails{
+		Server: lobbyapi.Server{RowId: "KU_1"},
+		Details: lobbyapi.Details{WorldGen: lobbyapi.WorldGen{Shards: []lobbyapi.ShardWorldGen{
+			{Location: "cave", Preset: "DST_CAVE", TaskSet: "cave_default", WorldSize: "default"},
+			{Location: "forest", Preset: "SURVIVAL_TOGETHER", TaskSet: "default", WorldSize: "huge", SeasonStart: "winter"},
+		}}},
+	}}
+	// details crawled but worldgen is not available
+	withoutWorldGen := repo.LobbyServerDetails{ServerDetails: lobbyapi.ServerDetails{
+		Server: lobbyapi.Server{RowId: "KU_2"},
+	}}
+
+	worldGens := serverWorldGens([]repo.LobbyServerDetails{withCaves, withoutWorldGen})
+	assert.DeepEqual(t, map[string]repo.LobbyWorldGen{
+		"KU_1": {
+			Presets:     []string{"DST_CAVE", "SURVIVAL_TOGETHER"},
+			Locations:   []string{"cave", "forest"},
+			TaskSet:     "default",
+			WorldSize:   "huge",
+			SeasonStart: "winter",
+		},
+	}, worldGens)
+}
+
+func TestGetServersByPageInvalidModsMatch(t *testing.T) {
+	handler := LobbyMongoHandler{}
+	_, err := handler.GetServersByPage(context.Background(), types.QueryLobbyServersOptions{Mods: "374550642", ModsMatch: "some"})
+	assert.True(t, errors.Is(err, ErrInvalidModsMatch))
+}
+
+func TestServersFilterServerType(t *testing.T) {
+	filter := serversFilter(types.QueryLobbyServersOptions{ServerType: 1})
+	assert.DeepEqual(t, bson.M{"is_dedicated": true}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{ServerType: 2})
+	assert.DeepEqual(t, bson.M{"client_hosted": true}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{ServerType: 3})
+	assert.DeepEqual(t, bson.M{"steam_clan_id": bson.M{"$nin": bson.A{"", nil}}}, filter)
+
+	filter = serversFilter(types.QueryLobbyServersOptions{})
+	assert.DeepEqual(t, 0, len(filter))
+}
+
+func TestServersFilterRange(t *testing.T) {
+	lower, upper := 2, 8
+	filter := serversFilter(types.QueryLobbyServersOptions{
+		OnlineMin:       &lower,
+		OnlineMax:       &upper,
+		FreeSlots:       1,
+		Season:          "winter",
+		AllowNewPlayers: 1,
+		LanOnly:         -1,
+	})
+
+	assert.DeepEqual(t, bson.M{
+		"connected":         bson.M{"$gte": 2, "$lte": 8},
+		"free_slots":        bson.M{"$gte": 1},
+		"season":            "winter",
+		"allow_new_players": true,
+		"lan_only":          false,
+	}, filter)
+
+	// empty servers only
+	zero := 0
+	filter = serversFilter(types.QueryLobbyServersOptions{OnlineMax: &zero})
+	assert.DeepEqual(t, bson.M{"connected": bson.M{"$lte": 0}}, filter)
+}
+
+func TestParseServersSort(t *testing.T) {
+	sorts, err := parseServersSort("-online, name")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []repo.SortField{{Field: "connected", Order: -1}, {Field: "name", Order: 1}}, sorts)
+
+	sorts, err = parseServersSort("")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 0, len(sorts))
+
+	_, err = parseServersSort("-password")
+	assert.True(t, errors.Is(err, ErrInvalidSort))
+
+	_, err = parseServersSort("name,-name")
+	assert.True(t, errors.Is(err, ErrInvalidSort))
+
+	sorts, err = parseServersSort("-relevance")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []repo.SortField{{Field: repo.ScoreField, Order: -1}}, sorts)
+}
+
+func TestCharacterStatistics(t *testing.T) {
+	server := func(mode string, prefabs ...string) repo.LobbyServerDetails {
+		detail := repo.LobbyServerDetails{Region: lobbyapi.ApEast}
+		detail.Platform = lobbyapi.Steam
+		detail.GameMode = mode
+		for _, prefab := range prefabs {
+			detail.Details.Players = append(detail.Details.Players, lobbyapi.Player{Prefab: prefab})
+		}
+		return detail
+	}
+
+	details := []repo.LobbyServerDetails{
+		server("survival", "wilson", "wilson", "wendy", ""),
+		server("survival", "wendy"),
+		server("endless", "wx78"),
+		// nobody picked
+		server("wilderness", ""),
+	}
+
+	statistics := characterStatistics(1, details)
+	assert.DeepEqual(t, 2, len(statistics))
+
+	survival := statistics[0]
+	assert.DeepEqual(t, "survival", survival.GameMode)
+	assert.DeepEqual(t, int64(4), survival.Players)
+	assert.DeepEqual(t, []repo.LobbyStatisticItem{
+		{Label: "wendy", TotalServers: 2, OnlinePlayers: 2},
+		{Label: "wilson", TotalServers: 1, OnlinePlayers: 2},
+	}, survival.Characters)
+
+	assert.DeepEqual(t, "endless", statistics[1].GameMode)
+	assert.DeepEqual(t, int64(1), statistics[1].Players)
+}
+
+func TestOfflinePeriods(t *testing.T) {
+	events := []repo.LobbyServerEvent{
+		{Type: repo.EventAppeared, Ts: 1},
+		{Type: repo.EventDisappeared, Ts: 10},
+		{Type: repo.EventAppeared, Ts: 20},
+		{Type: repo.EventDisappeared, Ts: 30},
+	}
+
+	periods := offlinePeriods(events)
+	assert.DeepEqual(t, [][2]int64{{10, 20}, {30, math.MaxInt64}}, periods)
+
+	assert.False(t, isOffline(periods, 9))
+	assert.True(t, isOffline(periods, 10))
+	assert.True(t, isOffline(periods, 19))
+	assert.False(t, isOffline(periods, 20))
+	assert.True(t, isOffline(periods, 40))
+}
@@ -1,25 +1,39 @@
 package handler
 
 import (
+	"cmp"
 	"context"
 	"github.com/dstgo/steamapi"
 	"github.com/dstgo/steamapi/types/publishedfile"
 	"github.com/dstgo/steamapi/types/steam"
+	"github.com/dstgo/tracker/internal/data/repo"
 	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"slices"
+	"time"
 )
 
 type ModHandler interface {
 	SearchModList(ctx context.Context, queryOption types.SearchModsOption) (publishedfile.FileList, error)
+	// GetPopularMods returns the most used mods among the latest crawled servers by page
+	GetPopularMods(ctx context.Context, options types.QueryPopularModsOption) (types.PageResult[repo.ModUsage], error)
+	// GetModUsage returns the time series of servers and online players that used the mod
+	GetModUsage(ctx context.Context, options types.QueryModUsageOption, step time.Duration) (types.QueryModUsageResp, error)
+	// GetRelatedMods returns the mods used together with the mod among the crawled servers of the latest snapshot,
+	// and the packs frequently combined with it
+	GetRelatedMods(ctx context.Context, options types.QueryRelatedModsOption) (types.QueryRelatedModsResp, error)
 }
 
-func NewWorkShopHandler(steamCLI *steamapi.Client) *WorkShopModHandler {
-	return &WorkShopModHandler{steamCLI: steamCLI}
+func NewWorkShopHandler(steamCLI *steamapi.Client, modRepo *repo.ModRepo, lobbyRepo *repo.LobbyRepo) *WorkShopModHandler {
+	return &WorkShopModHandler{steamCLI: steamCLI, modRepo: modRepo, lobbyRepo: lobbyRepo}
 }
 
 var _ ModHandler = (*WorkShopModHandler)(nil)
 
 type WorkShopModHandler struct {
-	steamCLI *steamapi.Client
+	steamCLI  *steamapi.Client
+	modRepo   *repo.ModRepo
+	lobbyRepo *repo.LobbyRepo
 }
 
 func (w *WorkShopModHandler) SearchModList(ctx context.Context, queryOption types.SearchModsOption) (publishedfile.FileList, error) {
@@ -42,3 +56,221 @@ func (w *WorkShopModHandler) SearchModList(ctx context.Context, queryOption type
 	}
 	return files, nil
 }
+
+func (w *WorkShopModHandler) GetPopularMods(ctx context.Context, options types.QueryPopularModsOption) (types.PageResult[repo.ModUsage], error) {
+	ts, err := w.modRepo.LatestTs(ctx)
+	if err != nil {
+		return types.PageResult[repo.ModUsage]{}, err
+	}
+
+	return w.modRepo.FindPopular(ctx, ts, repo.ModPopularQuery{
+		ModUsageQuery: modUsageQuery(options.Region, options.Platform),
+		Page:          options.Page,
+		Size:          options.Size,
+		SortBy:        options.Sort,
+	})
+}
+
+func (w *WorkShopModHandler) GetModUsage(ctx context.Context, options types.QueryModUsageOption, step time.Duration) (types.QueryModUsageResp, error) {
+	result := types.QueryModUsageResp{Id: options.Id, Points: []types.ModUsagePoint{}}
+
+	to, from := options.To, options.From
+	if to <= 0 {
+		to = time.Now().UnixMilli()
+	}
+	if from <= 0 {
+		from = to - (24 * time.Hour).Milliseconds()
+	}
+	if from > to {
+		return result, ErrInvalidRange
+	}
+
+	stepMs := max(step.Milliseconds(), time.Minute.Milliseconds())
+	// enlarge step if too many points
+	if points := (to-from)/stepMs + 1; points > MaxHistoryPoints {
+		stepMs = (to-from)/(MaxHistoryPoints-1) + 1
+	}
+	result.From, result.To, result.Step = from, to, stepMs
+
+	buckets, err := w.modRepo.FindUsage(ctx, options.Id, from, to, stepMs, modUsageQuery(options.Region, options.Platform))
+	if err != nil {
+		return result, err
+	}
+
+	// the crawls in each bucket, the mod is absent in some crawls if nobody used it
+	crawls, err := w.modRepo.FindTs(ctx, from, to)
+	if err != nil {
+		return result, err
+	}
+	samples := make(map[int64]int)
+	for _, ts := range crawls {
+		samples[ts-(ts-from)%stepMs]++
+	}
+
+	for _, bucket := range buckets {
+		n := float64(max(samples[bucket.Ts], 1))
+		result.Points = append(result.Points, types.ModUsagePoint{
+			Ts:      bucket.Ts,
+			Servers: float64(bucket.Servers) / n,
+			Players: float64(bucket.Players) / n,
+		})
+	}
+	return result, nil
+}
+
+func (w *WorkShopModHandler) GetRelatedMods(ctx context.Context, options types.QueryRelatedModsOption) (types.QueryRelatedModsResp, error) {
+	result := types.QueryRelatedModsResp{Id: options.Id, Related: []types.RelatedMod{}, Packs: []types.ModPack{}}
+
+	ts, err := w.lobbyRepo.LatestTs(ctx)
+	if err != nil || ts == 0 {
+		return result, err
+	}
+
+	sets, err := w.lobbyRepo.FindModSets(ctx, ts, options.Id)
+	if err != nil || len(sets) == 0 {
+		return result, err
+	}
+	result.Servers = len(sets)
+
+	minServers := max(options.MinServers, 1)
+	companions := coUsedMods(sets, options.Id, minServers)
+	packs := frequentPacks(sets, options.Id, companions, minServers)
+
+	companions = companions[:min(len(companions), options.Size)]
+	packs = packs[:min(len(packs), options.Size)]
+
+	// the total servers of companions for lift
+	modIds := []string{options.Id}
+	for _, companion := range companions {
+		modIds = append(modIds, companion.id)
+	}
+	for _, pack := range packs {
+		modIds = append(modIds, pack.ids...)
+	}
+	slices.Sort(modIds)
+	modIds = slices.Compact(modIds)
+
+	counts, total, err := w.lobbyRepo.CountMods(ctx, ts, modIds)
+	if err != nil {
+		return result, err
+	}
+
+	// names are not stored with servers, they come from the latest usages
+	usageTs, err := w.modRepo.LatestTs(ctx)
+	if err != nil {
+		return result, err
+	}
+	names, err := w.modRepo.FindNames(ctx, usageTs, modIds)
+	if err != nil {
+		return result, err
+	}
+	result.Name = names[options.Id]
+
+	for _, companion := range companions {
+		confidence := float64(companion.servers) / float64(result.Servers)
+		related := types.RelatedMod{Id: companion.id, Name: names[companion.id], Servers: companion.servers, Confidence: confidence}
+		if count := counts[companion.id]; count > 0 {
+			related.Lift = confidence / (float64(count) / float64(total))
+		}
+		result.Related = append(result.Related, related)
+	}
+
+	for _, pack := range packs {
+		modPack := types.ModPack{
+			Ids:     pack.ids,
+			Servers: pack.servers,
+			Support: float64(pack.servers) / float64(result.Servers),
+		}
+		for _, id := range pack.ids {
+			modPack.Names = append(modPack.Names, names[id])
+		}
+		result.Packs = append(result.Packs, modPack)
+	}
+
+	return result, nil
+}
+
+// modUsageQuery returns the usage query of region and platform option
+func modUsageQuery(region string, platform int) repo.ModUsageQuery {
+	query := repo.ModUsageQuery{Region: region}
+	if _, name, ok := lobbyapi.PlatformOf(lobbyapi.PlatformOption(platform)); ok {
+		query.PlatformName = name
+	}
+	return query
+}
+
+// modUsages returns the usages of enabled workshop mods among the servers crawled at ts, the most used first.
+// The usages are keyed by the crawl time rather than the snapshot, the snapshot could be the same across crawls.
+func modUsages(ts int64, details []repo.LobbyServerDetails) []repo.ModUsage {
+	type group struct {
+		region, platform string
+	}
+
+	var (
+		usages = make(map[string]*repo.ModUsage)
+		groups = make(map[string]map[group]*repo.ModUsageGroup)
+	)
+
+	for _, detail := range details {
+		key := group{detail.Region, lobbyapi.PlatformDisplayName(detail.Region, detail.Platform)}
+		// count the server once even if the mod is listed twice
+		counted := make(map[string]bool)
+
+		for _, mod := range detail.Details.Mods {
+			if !mod.Workshop || !mod.Enabled || counted[mod.Id] {
+				continue
+			}
+			counted[mod.Id] = true
+
+			usage, ok := usages[mod.Id]
+			if !ok {
+				usage = &repo.ModUsage{Ts: ts, ModId: mod.Id, Name: mod.Name}
+				usages[mod.Id] = usage
+				groups[mod.Id] = make(map[group]*repo.ModUsageGroup)
+			}
+			usage.Servers++
+			usage.Players += int64(detail.Connected)
+
+			usageGroup, ok := groups[mod.Id][key]
+			if !ok {
+				usageGroup = &repo.ModUsageGroup{Region: key.region, PlatformName: key.platform}
+				groups[mod.Id][key] = usageGroup
+			}
+			usageGroup.Servers++
+			usageGroup.Players += int64(detail.Connected)
+		}
+	}
+
+	result := make([]repo.ModUsage, 0, len(usages))
+	for id, usage := range usages {
+		for _, usageGroup := range groups[id] {
+			usage.Groups = append(usage.Groups, *usageGroup)
+		}
+		slices.SortFunc(usage.Groups, func(a, b repo.ModUsageGroup) int {
+			return cmp.Or(cmp.Compare(a.Region, b.Region), cmp.Compare(a.PlatformName, b.PlatformName))
+		})
+		result = append(result, *usage)
+	}
+
+	slices.SortFunc(result, func(a, b repo.ModUsage) int {
+		return cmp.Or(-cmp.Compare(a.Servers, b.Servers), cmp.Compare(a.ModId, b.ModId))
+	})
+	return result
+}
+
+// serverModIds returns the enabled workshop mods of the crawled servers keyed by rowId,
+// the servers without mods are included with empty ids
+func serverModIds(details []repo.LobbyServerDetails) map[string][]string {
+	modIds := make(map[string][]string, len(details))
+	for _, detail := range details {
+		ids := make([]string, 0, len(detail.Details.Mods))
+		for _, mod := range detail.Details.Mods {
+			if mod.Workshop && mod.Enabled {
+				ids = append(ids, mod.Id)
+			}
+		}
+		slices.Sort(ids)
+		modIds[detail.RowId] = slices.Compact(ids)
+	}
+	return modIds
+}
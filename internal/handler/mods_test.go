@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"testing"
+)
+
+func modServer(region string, connected int, mods ...lobbyapi.Mod) repo.LobbyServerDetails {
+	detail := repo.LobbyServerDetails{Region: region}
+	detail.Platform = lobbyapi.Steam
+	detail.Connected = connected
+	detail.Details.Mods = mods
+	return detail
+}
+
+func TestModUsages(t *testing.T) {
+	global := lobbyapi.Mod{Id: "378160973", Name: "Global Positions", Workshop: true, Enabled: true}
+	health := lobbyapi.Mod{Id: "375859599", Name: "Health Info", Workshop: true, Enabled: true}
+
+	details := []repo.LobbyServerDetails{
+		modServer(lobbyapi.ApEast, 3, global, health),
+		// listed twice
+		modServer(lobbyapi.UsEast1, 2, global, global),
+		modServer(lobbyapi.UsEast1, 1,
+			// disabled
+			lobbyapi.Mod{Id: "375859599", Workshop: true},
+			// local mod
+			lobbyapi.Mod{Id: "mymod", Enabled: true},
+		),
+	}
+
+	usages := modUsages(1, details)
+	assert.DeepEqual(t, 2, len(usages))
+
+	assert.DeepEqual(t, "378160973", usages[0].ModId)
+	assert.DeepEqual(t, int64(2), usages[0].Servers)
+	assert.DeepEqual(t, int64(5), usages[0].Players)
+	assert.DeepEqual(t, []repo.ModUsageGroup{
+		{Region: lobbyapi.ApEast, PlatformName: "Steam", Servers: 1, Players: 3},
+		{Region: lobbyapi.UsEast1, PlatformName: "Steam", Servers: 1, Players: 2},
+	}, usages[0].Groups)
+
+	assert.DeepEqual(t, "375859599", usages[1].ModId)
+	assert.DeepEqual(t, int64(1), usages[1].Servers)
+	assert.DeepEqual(t, int64(3), usages[1].Players)
+}
+
+func TestServerModIds(t *testing.T) {
+	global := lobbyapi.Mod{Id: "378160973", Workshop: true, Enabled: true}
+	health := lobbyapi.Mod{Id: "375859599", Workshop: true, Enabled: true}
+
+	withMods := modServer(lobbyapi.ApEast, 0, global, health, global, lobbyapi.Mod{Id: "mymod", Enabled: true})
+	withMods.RowId = "KU_1"
+	withoutMods := modServer(lobbyapi.ApEast, 0)
+	withoutMods.RowId = "KU_2"
+
+	modIds := serverModIds([]repo.LobbyServerDetails{withMods, withoutMods})
+	assert.DeepEqual(t, []string{"375859599", "378160973"}, modIds["KU_1"])
+	assert.DeepEqual(t, []string{}, modIds["KU_2"])
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"github.com/dstgo/tracker/pkg/search"
+	"strings"
+	"time"
+)
+
+// playerSightingGap is the max gap between two crawls that player presented in, that they are considered
+// as continuous presence. It should be larger than the interval of details crawler.
+const playerSightingGap = 30 * time.Minute
+
+// ErrPlayerRequired means that neither name nor netid is specified
+var ErrPlayerRequired = errors.New("name or netid is required")
+
+type PlayerHandler interface {
+	// SearchPlayers returns the sightings of players matched by netid or name prefix, the latest first
+	SearchPlayers(ctx context.Context, options types.SearchPlayersOption) (types.PageResult[repo.PlayerSighting], error)
+}
+
+func NewPlayerMongoHandler(playerRepo *repo.PlayerRepo) *PlayerMongoHandler {
+	return &PlayerMongoHandler{playerRepo: playerRepo}
+}
+
+var _ PlayerHandler = (*PlayerMongoHandler)(nil)
+
+type PlayerMongoHandler struct {
+	playerRepo *repo.PlayerRepo
+}
+
+func (p *PlayerMongoHandler) SearchPlayers(ctx context.Context, options types.SearchPlayersOption) (types.PageResult[repo.PlayerSighting], error) {
+	// blank name matches every sighting by prefix, so it is checked after folded
+	options.Name = search.Fold(options.Name)
+	options.NetId = strings.TrimSpace(options.NetId)
+	if options.Name == "" && options.NetId == "" {
+		return types.PageResult[repo.PlayerSighting]{}, ErrPlayerRequired
+	}
+
+	return p.playerRepo.FindSightings(ctx, repo.PlayerSightingsQuery{
+		Page:  options.Page,
+		Size:  options.Size,
+		NetId: options.NetId,
+		Name:  options.Name,
+	})
+}
+
+// playerSightings returns the online players in the crawled details, the players without netid are ignored
+func playerSightings(details []repo.LobbyServerDetails) []repo.PlayerSighting {
+	var sightings []repo.PlayerSighting
+	for _, detail := range details {
+		for _, player := range detail.Details.Players {
+			if player.SteamId == "" {
+				continue
+			}
+			sightings = append(sightings, repo.PlayerSighting{
+				NetId:        player.SteamId,
+				Name:         player.Name,
+				Prefab:       player.Prefab,
+				Colour:       player.Colour,
+				ServerId:     detail.ServerId,
+				RowId:        detail.RowId,
+				Region:       detail.Region,
+				PlatformName: lobbyapi.PlatformDisplayName(detail.Region, detail.Platform),
+				ServerName:   detail.Name,
+			})
+		}
+	}
+	return sightings
+}
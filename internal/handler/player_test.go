@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/internal/data/repo"
+	"github.com/dstgo/tracker/internal/types"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"testing"
+)
+
+func TestPlayerSightings(t *testing.T) {
+	details := []repo.LobbyServerDetails{{
+		Region:   lobbyapi.ApEast,
+		ServerId: "SV_1",
+		ServerDetails: lobbyapi.ServerDetails{
+			Server: lobbyapi.Server{RowId: "KU_1", Name: "foo", Platform: lobbyapi.Rail},
+			Details: lobbyapi.Details{Players: []lobbyapi.Player{
+				{Name: "wilson", Prefab: "wilson", SteamId: "KU_p1"},
+				// not joined yet
+				{Name: "", Prefab: "", SteamId: ""},
+			}},
+		},
+	}}
+
+	sightings := playerSightings(details)
+	assert.DeepEqual(t, 1, len(sightings))
+	assert.DeepEqual(t, "KU_p1", sightings[0].NetId)
+	assert.DeepEqual(t, "SV_1", sightings[0].ServerId)
+	assert.DeepEqual(t, "foo", sightings[0].ServerName)
+	assert.DeepEqual(t, lobbyapi.WeGame, sightings[0].PlatformName)
+}
+
+func TestSearchPlayersBlankName(t *testing.T) {
+	handler := PlayerMongoHandler{}
+	for _, options := range []types.SearchPlayersOption{{Name: "   "}, {Name: "\u3000"}, {NetId: " "}} {
+		_, err := handler.SearchPlayers(context.Background(), options)
+		assert.True(t, errors.Is(err, ErrPlayerRequired))
+	}
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"cmp"
+	"math/bits"
+	"slices"
+)
+
+const (
+	// maxPackCompanions limits the companions that could form packs, the most co-used ones are chosen
+	maxPackCompanions = 20
+	// maxPackSize limits the mods of single pack, includes the mod itself
+	maxPackSize = 5
+)
+
+// relatedMod is the mod co-used with the target mod
+type relatedMod struct {
+	id string
+	// servers that used both of them
+	servers int
+}
+
+// modPack is the set of mods used together on servers
+type modPack struct {
+	ids     []string
+	servers int
+}
+
+// coUsedMods returns the mods used together with id in sets by descending co-used servers,
+// the ones co-used by less than minServers are dropped. Each set is the mods of single server.
+func coUsedMods(sets [][]string, id string, minServers int) []relatedMod {
+	counts := make(map[string]int)
+	for _, set := range sets {
+		if !slices.Contains(set, id) {
+			continue
+		}
+		for _, other := range set {
+			if other != id {
+				counts[other]++
+			}
+		}
+	}
+
+	var related []relatedMod
+	for other, count := range counts {
+		if count >= minServers {
+			related = append(related, relatedMod{id: other, servers: count})
+		}
+	}
+	slices.SortFunc(related, func(a, b relatedMod) int {
+		return cmp.Or(-cmp.Compare(a.servers, b.servers), cmp.Compare(a.id, b.id))
+	})
+	return related
+}
+
+// frequentPacks returns the packs that contain id and at least two of its companions, used by at least minServers.
+// It is apriori over the bitmasks of companions, so only the first maxPackCompanions of companions are considered.
+// The packs contained by a larger pack of the same servers are dropped, since they carry no more information.
+func frequentPacks(sets [][]string, id string, companions []relatedMod, minServers int) []modPack {
+	companions = companions[:min(len(companions), maxPackCompanions)]
+	bit := make(map[string]uint32, len(companions))
+	for i, companion := range companions {
+		bit[companion.id] = 1 << i
+	}
+
+	var masks []uint32
+	for _, set := range sets {
+		if !slices.Contains(set, id) {
+			continue
+		}
+		var mask uint32
+		for _, other := range set {
+			mask |= bit[other]
+		}
+		if bits.OnesCount32(mask) >= 2 {
+			masks = append(masks, mask)
+		}
+	}
+
+	support := func(candidate uint32) int {
+		var count int
+		for _, mask := range masks {
+			if mask&candidate == candidate {
+				count++
+			}
+		}
+		return count
+	}
+
+	// level 1 is the companions themselves, they are frequent already
+	level := make([]uint32, 0, len(companions))
+	for i := range companions {
+		level = append(level, 1<<i)
+	}
+
+	found := make(map[uint32]int)
+	for size := 2; size < maxPackSize && len(level) > 0; size++ {
+		var next []uint32
+		for _, itemset := range level {
+			// extend by the companions after the highest one, so each candidate is generated once
+			for i := bits.Len32(itemset); i < len(companions); i++ {
+				candidate := itemset | 1<<i
+				if count := support(candidate); count >= minServers {
+					found[candidate] = count
+					next = append(next, candidate)
+				}
+			}
+		}
+		level = next
+	}
+
+	var packs []modPack
+	for mask, count := range found {
+		closed := true
+		for other, otherCount := range found {
+			if other != mask && other&mask == mask && otherCount == count {
+				closed = false
+				break
+			}
+		}
+		if !closed {
+			continue
+		}
+
+		pack := modPack{ids: []string{id}, servers: count}
+		for i, companion := range companions {
+			if mask&(1<<i) != 0 {
+				pack.ids = append(pack.ids, companion.id)
+			}
+		}
+		packs = append(packs, pack)
+	}
+
+	slices.SortFunc(packs, func(a, b modPack) int {
+		return cmp.Or(-cmp.Compare(a.servers, b.servers), -cmp.Compare(len(a.ids), len(b.ids)), slices.Compare(a.ids, b.ids))
+	})
+	return packs
+}
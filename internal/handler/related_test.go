@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"testing"
+)
+
+func TestCoUsedMods(t *testing.T) {
+	sets := [][]string{
+		{"x", "a", "b", "c"},
+		{"x", "a", "b"},
+		{"x", "a", "d"},
+		// without x
+		{"a", "b", "c"},
+	}
+
+	related := coUsedMods(sets, "x", 2)
+	assert.DeepEqual(t, []relatedMod{{"a", 3}, {"b", 2}}, related)
+}
+
+func TestFrequentPacks(t *testing.T) {
+	sets := [][]string{
+		{"x", "a", "b", "c"},
+		{"x", "a", "b", "c"},
+		{"x", "a", "b"},
+		{"x", "a", "d"},
+		{"x", "c"},
+	}
+
+	companions := coUsedMods(sets, "x", 2)
+	packs := frequentPacks(sets, "x", companions, 2)
+
+	// {x, a, c} and {x, b, c} are contained by {x, a, b, c} of the same servers
+	assert.DeepEqual(t, []modPack{
+		{ids: []string{"x", "a", "b"}, servers: 3},
+		{ids: []string{"x", "a", "b", "c"}, servers: 2},
+	}, packs)
+}
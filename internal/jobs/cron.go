@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"github.com/dstgo/tracker/conf"
 	"github.com/dstgo/tracker/internal/handler"
 	"github.com/dstgo/tracker/internal/types"
@@ -22,14 +23,15 @@ func (c cronLogger) Error(err error, msg string, keysAndValues ...interface{}) {
 	c.logger.Error(c.prefab+": "+msg, append([]any{"err", err}, keysAndValues...)...)
 }
 
-func LoadCronJobs(dstConf conf.DstConf, lobbyHandler handler.LobbyHandler) (*cron.Cron, error) {
+// LoadCronJobs registers all the cron jobs, running jobs will be canceled once ctx is done
+func LoadCronJobs(ctx context.Context, dstConf conf.DstConf, lobbyHandler handler.LobbyHandler) (*cron.Cron, error) {
 	cronJob := cron.New(
 		cron.WithLogger(cronLogger{logger: slog.Default(), prefab: "CRON"}),
 		cron.WithLocation(types.TimeZone),
 	)
 
 	// lobby collector
-	lobbyCollector := LobbyCollector{dstConf.Lobby, lobbyHandler, cronJob}
+	lobbyCollector := LobbyCollector{ctx, dstConf.Lobby, lobbyHandler, cronJob}
 	if _, err := cronJob.AddFunc(dstConf.Lobby.CollectCron, lobbyCollector.Collect); err != nil {
 		return nil, err
 	}
@@ -37,5 +39,13 @@ func LoadCronJobs(dstConf conf.DstConf, lobbyHandler handler.LobbyHandler) (*cro
 		return nil, err
 	}
 
+	// details crawler
+	if dstConf.Lobby.Details.Enable {
+		detailsCrawler := DetailsCrawler{ctx, dstConf.Lobby.Details, lobbyHandler}
+		if _, err := cronJob.AddFunc(dstConf.Lobby.Details.Cron, detailsCrawler.Crawl); err != nil {
+			return nil, err
+		}
+	}
+
 	return cronJob, nil
 }
@@ -0,0 +1,34 @@
+package jobs
+
+import (
+	"context"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/dstgo/tracker/conf"
+	"github.com/dstgo/tracker/internal/handler"
+	"time"
+)
+
+// DetailsCrawler crawls server details of the latest snapshot from klei lobby
+type DetailsCrawler struct {
+	// parent context of all jobs, canceled on shutdown
+	ctx     context.Context
+	conf    conf.LobbyDetailsConf
+	handler handler.LobbyHandler
+}
+
+// Crawl crawls server details and stores them
+func (d DetailsCrawler) Crawl() {
+	start := time.Now()
+	// max cost time duration
+	ctx, cancelFunc := context.WithTimeout(d.ctx, d.conf.Timeout)
+	defer cancelFunc()
+
+	stored, failed, err := d.handler.CrawlServerDetails(ctx, d.conf.Concurrency, d.conf.Budget)
+	if err != nil {
+		hlog.Errorf("DETAILS_CRAWLER: error=%v", err)
+		return
+	}
+
+	cost := time.Now().Sub(start).String()
+	hlog.Infof("DETAILS_CRAWLER: cost=%s stored=%d failed=%d", cost, stored, failed)
+}
@@ -11,6 +11,8 @@ import (
 
 // LobbyCollector collects server information from klei lobby
 type LobbyCollector struct {
+	// parent context of all jobs, canceled on shutdown
+	ctx     context.Context
 	conf    conf.LobbyConf
 	handler handler.LobbyHandler
 	cron    *cron.Cron
@@ -20,11 +22,11 @@ type LobbyCollector struct {
 func (l LobbyCollector) Collect() {
 	start := time.Now()
 	// max cost time duration
-	ctx, cancelFunc := context.WithTimeout(context.Background(), l.conf.Timeout)
+	ctx, cancelFunc := context.WithTimeout(l.ctx, l.conf.Timeout)
 	defer cancelFunc()
 
 	// collect
-	collected, err := l.handler.SyncLocalServers(ctx, 20)
+	report, err := l.handler.SyncLocalServers(ctx, 20)
 	if err != nil {
 		hlog.Errorf("LOBBY_COLLECTOR: error=%v", err)
 		return
@@ -32,7 +34,7 @@ func (l LobbyCollector) Collect() {
 
 	// log events
 	cost := time.Now().Sub(start).String()
-	hlog.Infof("LOBBY_COLLECTOR: cost=%s collected=%d", cost, collected)
+	hlog.Infof("LOBBY_COLLECTOR: cost=%s collected=%d succeeded=%d failed=%d", cost, report.Servers, report.Succeeded, report.Failed)
 }
 
 // Clear clears expired data
@@ -40,7 +42,7 @@ func (l LobbyCollector) Clear() {
 	start := time.Now()
 
 	// clear expired
-	deleted, total, err := l.handler.ClearExpiredServers(context.Background(), l.conf.TTL)
+	deleted, total, err := l.handler.ClearExpiredServers(l.ctx, l.conf.TTL)
 	if err != nil {
 		hlog.Errorf("LOBBY_COLLECTOR: error=%v", err)
 		return
@@ -5,14 +5,24 @@ import (
 )
 
 type QueryLobbyServersOptions struct {
-	Page int    `query:"page" default:"1" binding:"gt=0"`
-	Size int    `query:"size" default:"10" binding:"gt=0,lte=100"`
-	Sort string `query:"sort" default:"name"`
+	Page int `query:"page" default:"1" binding:"gt=0"`
+	Size int `query:"size" default:"10" binding:"gt=0,lte=100"`
+	// next or prev cursor returned by the last page, page will be ignored if specified,
+	// sort must be the same as the last page.
+	Cursor string `query:"cursor"`
+	// comma separated fields, prefixed with "-" for descending order, e.g. -online,name.
+	// available fields: name, online, maxPlayers, freeSlots, version, region, area, platform, mode, intent, season, rowId,
+	// and relevance if searching by name. Defaults to name, or -relevance if searching by name.
+	Sort string `query:"sort"`
+
+	// stable server id across rowIds
+	ServerId string `query:"serverId"`
 
 	// network query options
 	Address string `query:"address"`
 	// area code
 	Area string `query:"area"`
+	// see lobbyapi.PlatformOption
 	// 0.All
 	// 1-Steam
 	// 2-WeGame
@@ -20,31 +30,71 @@ type QueryLobbyServersOptions struct {
 	// 4-Xbox
 	// 5-Ps4Official
 	// 6-NS
-	Platform int `query:"platform"`
+	Platform int `query:"platform" binding:"gte=0,lte=6"`
+	// see lobbyapi.ServerType
 	// 0 - all
 	// 1 - dedicated
 	// 2 - clienthosted
 	// 3 - steamgroup
-	ServerType int `query:"server_type"`
+	ServerType int `query:"server_type" binding:"gte=0,lte=3"`
 
 	// game query options
+	// full-text search over name, tags and host, chinese is supported
 	Name string `query:"name"`
 	// format like tag1,tag2,tag3,tag4,tag5
-	Tags     string `query:"tags"`
-	GameMode string `query:"game_mode"`
-	Intent   string `query:"intent"`
+	Tags string `query:"tags"`
+	// workshop ids of mods, format like 374550642,378160973. Only the crawled servers are matched.
+	Mods string `query:"mods"`
+	// any or all of the mods are enabled, the others are rejected
+	ModsMatch string `query:"mods_match" default:"any"`
+	GameMode  string `query:"game_mode"`
+	Intent    string `query:"intent"`
+
+	Season string `query:"season"`
+	// game version
+	Version int `query:"v" binding:"gte=0"`
+
+	// world generation query options, only the crawled servers are matched
+	// preset id of any shard, e.g. SURVIVAL_TOGETHER, LIGHTS_OUT, DST_CAVE
+	WorldPreset string `query:"world_preset"`
+	// overrides of the forest shard, e.g. task_set=classic, world_size=huge, start_location=darkness, season_start=winter
+	TaskSet       string `query:"task_set"`
+	WorldSize     string `query:"world_size"`
+	StartLocation string `query:"start_location"`
+	SeasonStart   string `query:"season_start"`
+	// -1 without caves
+	//  0 ignored
+	//  1 with caves
+	Caves int `query:"caves"`
+
+	// geo query options
+	Continent string `query:"continent"`
+	City      string `query:"city"`
+
+	// range of online players, both inclusive, nil means unbounded
+	OnlineMin *int `query:"online_min" binding:"omitempty,gte=0"`
+	OnlineMax *int `query:"online_max" binding:"omitempty,gte=0"`
+	// at least free slots, that is max players minus online players
+	FreeSlots int `query:"free_slots" binding:"gte=0"`
 
 	// -1 off
 	//  0 ignored
 	//  1 on
-	PvpEnabled  int `query:"pvp"`
-	ModEnabled  int `query:"mod"`
-	HasPassword int `query:"password"`
+	PvpEnabled      int `query:"pvp"`
+	ModEnabled      int `query:"mod"`
+	HasPassword     int `query:"password"`
+	AllowNewPlayers int `query:"allow_new_players"`
+	ServerPaused    int `query:"paused"`
+	FriendOnly      int `query:"friend_only"`
+	ClanOnly        int `query:"clan_only"`
+	LanOnly         int `query:"lan_only"`
 }
 
 type QueryLobbyServersResp struct {
 	// network
-	RowId       string `json:"rowId"`
+	RowId string `json:"rowId"`
+	// stable server id across rowIds
+	ServerId    string `json:"serverId"`
 	SteamClanId string `json:"steamClanId"`
 	Address     string `json:"address"`
 	Port        int    `json:"port"`
@@ -59,12 +109,14 @@ type QueryLobbyServersResp struct {
 	Platform     int    `json:"platform"`
 
 	// game options
-	Version    int      `json:"version"`
-	Name       string   `json:"name"`
-	GameMode   string   `json:"mode"`
-	Intent     string   `json:"intent"`
-	Season     string   `json:"season"`
-	Tags       []string `json:"tags"`
+	Version  int      `json:"version"`
+	Name     string   `json:"name"`
+	GameMode string   `json:"mode"`
+	Intent   string   `json:"intent"`
+	Season   string   `json:"season"`
+	Tags     []string `json:"tags"`
+	// workshop ids of enabled mods, empty if details never crawled
+	ModIds     []string `json:"modIds,omitempty"`
 	MaxPlayers int      `json:"maxPlayers"`
 	Online     int      `json:"online"`
 
@@ -80,9 +132,16 @@ type QueryLobbyServersResp struct {
 	ClanOnly        bool `json:"clanOnly"`
 }
 
+// QueryLobbyServerDetailsOption specifies the server by serverId, or rowId with region
 type QueryLobbyServerDetailsOption struct {
-	RowId  string `query:"rowId" binding:"required"`
-	Region string `query:"region" binding:"required"`
+	ServerId string `query:"serverId" json:"serverId"`
+	RowId    string `query:"rowId" json:"rowId"`
+	Region   string `query:"region" json:"region"`
+}
+
+type QueryLobbyServerDetailsBatchOption struct {
+	// at most 50 servers in one batch
+	Servers []QueryLobbyServerDetailsOption `json:"servers" binding:"required"`
 }
 
 type QueryLobbyServerDetailResp struct {
@@ -90,9 +149,110 @@ type QueryLobbyServerDetailResp struct {
 	lobbyapi.Details
 }
 
+type QueryLobbyServerDetailBatchItem struct {
+	RowId    string                      `json:"rowId"`
+	Region   string                      `json:"region"`
+	ServerId string                      `json:"serverId,omitempty"`
+	Details  *QueryLobbyServerDetailResp `json:"details,omitempty"`
+	// same as the status code of single details api if failed
+	Code  int    `json:"code,omitempty"`
+	Error string `json:"error,omitempty"`
+	// error returned by lobby, not exposed in json
+	Err error `json:"-"`
+}
+
 type QueryLobbyStatisticOption struct {
 	Until    int64  `query:"until" binding:"gt=0"`
 	Before   int64  `query:"before" binding:"gt=0"`
 	Tail     int64  `query:"tail" binding:"gt=0"`
 	Duration string `query:"duration" default:"1h"`
 }
+
+type QueryLobbyCollectOption struct {
+	Until  int64 `query:"until" binding:"gte=0"`
+	Before int64 `query:"before" binding:"gte=0"`
+	Tail   int64 `query:"tail" default:"10" binding:"gt=0,lte=100"`
+}
+
+// QueryLobbyHistoryOption specifies the server by rowId or serverId, the history is across rowIds either way
+type QueryLobbyHistoryOption struct {
+	RowId    string `query:"rowId"`
+	ServerId string `query:"serverId"`
+	// milliseconds timestamp, defaults to 24 hours before to
+	From int64 `query:"from" binding:"gte=0"`
+	// milliseconds timestamp, defaults to now
+	To int64 `query:"to" binding:"gte=0"`
+	// interval between points, it will be enlarged if there are too many points
+	Step string `query:"step" default:"10m"`
+}
+
+// LobbyHistoryPoint is the state of server at Ts
+type LobbyHistoryPoint struct {
+	Ts     int64 `json:"ts"`
+	Online int   `json:"online"`
+	// max online players during the step
+	OnlinePeak int    `json:"onlinePeak"`
+	MaxPlayers int    `json:"maxPlayers"`
+	Season     string `json:"season"`
+	// the latest crawled day, 0 if details never crawled
+	Day     int  `json:"day"`
+	Paused  bool `json:"paused"`
+	Version int  `json:"version"`
+}
+
+type QueryLobbyHistoryResp struct {
+	// the latest rowId
+	RowId    string `json:"rowId"`
+	ServerId string `json:"serverId"`
+	Name     string `json:"name"`
+	From     int64  `json:"from"`
+	To       int64  `json:"to"`
+	// milliseconds
+	Step int64 `json:"step"`
+	// points before the server appeared, while it was offline, or after it disappeared are omitted
+	Points []LobbyHistoryPoint `json:"points"`
+}
+
+type QueryLobbyEventsOption struct {
+	Page int `query:"page" default:"1" binding:"gt=0"`
+	Size int `query:"size" default:"10" binding:"gt=0,lte=100"`
+
+	ServerId string `query:"serverId"`
+	Region   string `query:"region"`
+	// comma separated event types: appeared, disappeared, restarted, wiped. Empty means all.
+	Type string `query:"type"`
+	// milliseconds timestamp range, both inclusive, 0 means unbounded
+	From int64 `query:"from" binding:"gte=0"`
+	To   int64 `query:"to" binding:"gte=0"`
+}
+
+type QueryLobbyCharacterOption struct {
+	Region string `query:"region"`
+	// see QueryLobbyServersOptions.Platform
+	Platform int    `query:"platform" binding:"gte=0,lte=6"`
+	GameMode string `query:"game_mode"`
+	// milliseconds timestamp, defaults to 7 days before to
+	From int64 `query:"from" binding:"gte=0"`
+	// milliseconds timestamp, defaults to now
+	To int64 `query:"to" binding:"gte=0"`
+	// interval between points, it will be enlarged if there are too many points
+	Step string `query:"step" default:"1h"`
+}
+
+type LobbyCharacterItem struct {
+	// character prefab, e.g. wilson, wendy, wx78
+	Prefab string `json:"prefab"`
+	// average players picked the character per crawl
+	Players float64 `json:"players"`
+	// share of the character in all the picks
+	Ratio float64 `json:"ratio"`
+}
+
+// LobbyCharacterPoint is the character distribution during the step starting at Ts
+type LobbyCharacterPoint struct {
+	Ts int64 `json:"ts"`
+	// average players who have picked characters per crawl
+	Players float64 `json:"players"`
+	// the most picked first
+	Characters []LobbyCharacterItem `json:"characters"`
+}
@@ -17,3 +17,99 @@ type SearchModsResult struct {
 	Total int                  `json:"total"`
 	List  []publishedfile.File `json:"list"`
 }
+
+type QueryPopularModsOption struct {
+	Page int `query:"page" binding:"gt=0" default:"1"`
+	Size int `query:"size" binding:"gt=0,lte=100" default:"10"`
+	// servers or players
+	Sort   string `query:"sort" default:"servers"`
+	Region string `query:"region"`
+	// see QueryLobbyServersOptions.Platform
+	Platform int `query:"platform" binding:"gte=0,lte=6"`
+}
+
+type QueryModUsageOption struct {
+	// workshop id
+	Id     string `path:"id" binding:"required"`
+	Region string `query:"region"`
+	// see QueryLobbyServersOptions.Platform
+	Platform int `query:"platform" binding:"gte=0,lte=6"`
+	// milliseconds timestamp, defaults to 24 hours before to
+	From int64 `query:"from" binding:"gte=0"`
+	// milliseconds timestamp, defaults to now
+	To int64 `query:"to" binding:"gte=0"`
+	// interval between points, it will be enlarged if there are too many points
+	Step string `query:"step" default:"1h"`
+}
+
+// ModUsagePoint is the average usage of mod per crawl during the step starting at Ts
+type ModUsagePoint struct {
+	Ts      int64   `json:"ts"`
+	Servers float64 `json:"servers"`
+	Players float64 `json:"players"`
+}
+
+type QueryModUsageResp struct {
+	// workshop id
+	Id   string `json:"id"`
+	From int64  `json:"from"`
+	To   int64  `json:"to"`
+	// milliseconds
+	Step int64 `json:"step"`
+	// the steps that mod was unused are omitted
+	Points []ModUsagePoint `json:"points"`
+}
+
+type QueryModServersOption struct {
+	// workshop id
+	Id   string `path:"id" binding:"required"`
+	Page int    `query:"page" binding:"gt=0" default:"1"`
+	Size int    `query:"size" binding:"gt=0,lte=100" default:"10"`
+	// see QueryLobbyServersOptions.Cursor
+	Cursor string `query:"cursor"`
+	// see QueryLobbyServersOptions.Sort
+	Sort string `query:"sort" default:"-online"`
+}
+
+type QueryRelatedModsOption struct {
+	// workshop id
+	Id string `path:"id" binding:"required"`
+	// max number of related mods and packs
+	Size int `query:"size" binding:"gt=0,lte=50" default:"10"`
+	// the mods or packs used by fewer servers are ignored
+	MinServers int `query:"min_servers" binding:"gt=0" default:"2"`
+}
+
+type RelatedMod struct {
+	// workshop id
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// servers that used both of the mods
+	Servers int `json:"servers"`
+	// ratio of the servers using the mod that also use this one
+	Confidence float64 `json:"confidence"`
+	// confidence divided by the ratio of all the crawled servers using this one,
+	// greater than 1 means they are used together more often than by chance
+	Lift float64 `json:"lift"`
+}
+
+type ModPack struct {
+	// workshop ids, the queried mod first
+	Ids   []string `json:"ids"`
+	Names []string `json:"names"`
+	// servers that used all the mods
+	Servers int `json:"servers"`
+	// ratio of the servers using the queried mod that used the whole pack
+	Support float64 `json:"support"`
+}
+
+type QueryRelatedModsResp struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	// crawled servers of the latest snapshot that used the mod
+	Servers int `json:"servers"`
+	// servers using the mod also use them, the most co-used first
+	Related []RelatedMod `json:"related"`
+	// mods frequently combined with the mod, at least three mods in each pack
+	Packs []ModPack `json:"packs"`
+}
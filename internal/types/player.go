@@ -0,0 +1,10 @@
+package types
+
+type SearchPlayersOption struct {
+	Page int `query:"page" binding:"gt=0" default:"1"`
+	Size int `query:"size" binding:"gt=0,lte=100" default:"10"`
+	// matched by prefix, case insensitive
+	Name string `query:"name"`
+	// klei user id, e.g. KU_xxxxxxxx
+	NetId string `query:"netid"`
+}
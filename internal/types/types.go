@@ -22,6 +22,9 @@ func init() {
 type PageResult[T any] struct {
 	Total int64 `json:"total"`
 	List  []T   `json:"list"`
+	// opaque cursors of the next and previous page, empty if no more page
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
 }
 
 type Env struct {
@@ -0,0 +1,51 @@
+package lobbyapi
+
+import (
+	"context"
+	"golang.org/x/sync/errgroup"
+)
+
+// DetailsQuery identifies a server in lobby
+type DetailsQuery struct {
+	Region string `json:"region"`
+	RowId  string `json:"rowId"`
+}
+
+// DetailsResult is the outcome of single query in batch
+type DetailsResult struct {
+	DetailsQuery
+	Details ServerDetails
+	Err     error
+}
+
+// GetServerDetailsBatch returns the details information for many servers with at most limit concurrent requests.
+// The results are in the same order as queries, failed queries carry their own error and never affect the others,
+// the unfinished queries will fail with ctx error once ctx is done.
+func (c *Client) GetServerDetailsBatch(ctx context.Context, queries []DetailsQuery, limit int) []DetailsResult {
+	results := make([]DetailsResult, len(queries))
+
+	if limit <= 0 {
+		limit = 1
+	}
+
+	var group errgroup.Group
+	group.SetLimit(limit)
+
+	for i, query := range queries {
+		results[i].DetailsQuery = query
+
+		group.Go(func() error {
+			// no need to send request if ctx has been done
+			if err := ctx.Err(); err != nil {
+				results[i].Err = err
+				return nil
+			}
+			results[i].Details, results[i].Err = c.GetServerDetailsWithContext(ctx, query.Region, query.RowId)
+			return nil
+		})
+	}
+
+	_ = group.Wait()
+
+	return results
+}
@@ -0,0 +1,282 @@
+package lobbyapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+	"strings"
+	"sync"
+	"time"
+)
+
+// decode errors, use errors.Is to check the kind of DecodeError
+var (
+	// ErrPayloadTooLarge means that the size of payload exceeds the limit
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrPayloadNotAllowed means that the payload is not a pure data script
+	ErrPayloadNotAllowed = errors.New("payload not allowed")
+	// ErrTooManyInstructions means that the compiled payload exceeds the instruction limit
+	ErrTooManyInstructions = errors.New("too many instructions")
+	// ErrUnexpectedType means that the lua value is not the expected type
+	ErrUnexpectedType = errors.New("unexpected type")
+)
+
+// DecodeError is returned when failed to decode lua payload from lobby
+type DecodeError struct {
+	// payload field, e.g. data, players, worldgen
+	Field string
+	// path of the value in payload, e.g. [1].eventlevel
+	Path string
+	Err  error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("lobbyapi: decode %s%s: %v", e.Field, e.Path, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// DecoderOption configures the LuaDecoder
+type DecoderOption func(d *LuaDecoder)
+
+// WithMaxPayloadSize limits the bytes of single payload
+func WithMaxPayloadSize(size int) DecoderOption {
+	return func(d *LuaDecoder) {
+		d.maxSize = size
+	}
+}
+
+// WithMaxInstructions limits the instructions of compiled payload
+func WithMaxInstructions(n int) DecoderOption {
+	return func(d *LuaDecoder) {
+		d.maxInstructions = n
+	}
+}
+
+// WithMaxRegistry limits the registry size of lua state, that is the memory used by lua values on stack
+func WithMaxRegistry(size int) DecoderOption {
+	return func(d *LuaDecoder) {
+		d.maxRegistry = size
+	}
+}
+
+// WithDecodeTimeout limits the execution time of single payload
+func WithDecodeTimeout(timeout time.Duration) DecoderOption {
+	return func(d *LuaDecoder) {
+		d.timeout = timeout
+	}
+}
+
+// NewLuaDecoder returns a new lua payload decoder
+func NewLuaDecoder(options ...DecoderOption) *LuaDecoder {
+	d := &LuaDecoder{
+		maxSize:         1 << 20,
+		maxInstructions: 1 << 16,
+		maxRegistry:     1 << 16,
+		timeout:         time.Second,
+	}
+
+	for _, option := range options {
+		option(d)
+	}
+
+	d.pool.New = func() any {
+		return lua.NewState(lua.Options{
+			// no base libraries, payloads are pure data
+			SkipOpenLibs:    true,
+			CallStackSize:   16,
+			RegistrySize:    256,
+			RegistryMaxSize: d.maxRegistry,
+		})
+	}
+
+	return d
+}
+
+// LuaDecoder decodes the lua payloads from lobby, such as data, players and worldgen.
+// The payload must be a pure data script like "return { ... }" which only contains literals and table constructors,
+// so it runs without base libraries, and its instructions, memory and execution time are limited.
+// The lua states are reused from pool, it is safe for concurrent use.
+type LuaDecoder struct {
+	maxSize         int
+	maxInstructions int
+	maxRegistry     int
+	timeout         time.Duration
+
+	pool sync.Pool
+}
+
+var defaultDecoder = NewLuaDecoder()
+
+// Decode executes the payload and returns the value it returns
+func (d *LuaDecoder) Decode(ctx context.Context, field, payload string) (value lua.LValue, err error) {
+	var L *lua.LState
+	// recover from unexpected panics so that the request handlers would not crash,
+	// it is the only deferred function that returns the state, so err is already set if panic occurred
+	defer func() {
+		if r := recover(); r != nil {
+			err = &DecodeError{Field: field, Err: fmt.Errorf("panic: %v", r)}
+		}
+		if L == nil {
+			return
+		}
+		// the state may be broken if failed, do not put it back
+		if err == nil {
+			d.pool.Put(L)
+		} else {
+			L.Close()
+		}
+	}()
+
+	if d.maxSize > 0 && len(payload) > d.maxSize {
+		return lua.LNil, &DecodeError{Field: field, Err: ErrPayloadTooLarge}
+	}
+
+	proto, err := d.compile(field, payload)
+	if err != nil {
+		return lua.LNil, err
+	}
+
+	L = d.pool.Get().(*lua.LState)
+
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	L.SetContext(ctx)
+	defer L.RemoveContext()
+
+	// isolated globals for each run
+	env := L.NewTable()
+	L.G.Global = env
+	L.Env = env
+
+	L.SetTop(0)
+	L.Push(L.NewFunctionFromProto(proto))
+	if err := L.PCall(0, 1, nil); err != nil {
+		return lua.LNil, &DecodeError{Field: field, Err: err}
+	}
+
+	value = L.Get(-1)
+	L.SetTop(0)
+	return value, nil
+}
+
+// DecodeTable is the same as Decode, but the returned value must be a table
+func (d *LuaDecoder) DecodeTable(ctx context.Context, field, payload string) (*lua.LTable, error) {
+	value, err := d.Decode(ctx, field, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	table, ok := value.(*lua.LTable)
+	if !ok {
+		return nil, &DecodeError{Field: field, Err: fmt.Errorf("%w: expected table, got %s", ErrUnexpectedType, value.Type())}
+	}
+	return table, nil
+}
+
+// compile parses the payload and checks whether it is a pure data script
+func (d *LuaDecoder) compile(field, payload string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(payload), field)
+	if err != nil {
+		return nil, &DecodeError{Field: field, Err: err}
+	}
+
+	if err := checkDataChunk(chunk); err != nil {
+		return nil, &DecodeError{Field: field, Err: err}
+	}
+
+	proto, err := lua.Compile(chunk, field)
+	if err != nil {
+		return nil, &DecodeError{Field: field, Err: err}
+	}
+
+	// there are no loops in pure data script, so the executed instructions never exceed the compiled ones
+	if d.maxInstructions > 0 && len(proto.Code) > d.maxInstructions {
+		return nil, &DecodeError{Field: field, Err: ErrTooManyInstructions}
+	}
+
+	return proto, nil
+}
+
+// checkDataChunk checks that chunk only contains a return statement with literals and table constructors
+func checkDataChunk(chunk []ast.Stmt) error {
+	for _, stmt := range chunk {
+		ret, ok := stmt.(*ast.ReturnStmt)
+		if !ok {
+			return fmt.Errorf("%w: statement %T at line %d", ErrPayloadNotAllowed, stmt, stmt.Line())
+		}
+		for _, expr := range ret.Exprs {
+			if err := checkDataExpr(expr); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkDataExpr(expr ast.Expr) error {
+	switch e := expr.(type) {
+	case *ast.NilExpr, *ast.TrueExpr, *ast.FalseExpr, *ast.NumberExpr, *ast.StringExpr:
+		return nil
+	case *ast.UnaryMinusOpExpr:
+		if _, ok := e.Expr.(*ast.NumberExpr); ok {
+			return nil
+		}
+	case *ast.TableExpr:
+		for _, field := range e.Fields {
+			if field.Key != nil {
+				if err := checkDataExpr(field.Key); err != nil {
+					return err
+				}
+			}
+			if err := checkDataExpr(field.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: expression %T at line %d", ErrPayloadNotAllowed, expr, expr.Line())
+}
+
+// luaTable returns the table value, nil for nil
+func luaTable(value lua.LValue, field, path string) (*lua.LTable, error) {
+	switch v := value.(type) {
+	case *lua.LTable:
+		return v, nil
+	case *lua.LNilType:
+		return nil, nil
+	}
+	return nil, &DecodeError{Field: field, Path: path, Err: fmt.Errorf("%w: expected table, got %s", ErrUnexpectedType, value.Type())}
+}
+
+// luaString returns the string value, empty string for nil
+func luaString(value lua.LValue, field, path string) (string, error) {
+	switch v := value.(type) {
+	case lua.LString:
+		return string(v), nil
+	case lua.LNumber, lua.LBool:
+		return v.String(), nil
+	case *lua.LNilType:
+		return "", nil
+	}
+	return "", &DecodeError{Field: field, Path: path, Err: fmt.Errorf("%w: expected string, got %s", ErrUnexpectedType, value.Type())}
+}
+
+// luaInt returns the int value, 0 for nil
+func luaInt(value lua.LValue, field, path string) (int, error) {
+	switch v := value.(type) {
+	case lua.LNumber:
+		return int(v), nil
+	case *lua.LNilType:
+		return 0, nil
+	}
+	return 0, &DecodeError{Field: field, Path: path, Err: fmt.Errorf("%w: expected number, got %s", ErrUnexpectedType, value.Type())}
+}
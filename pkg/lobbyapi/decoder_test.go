@@ -0,0 +1,169 @@
+package lobbyapi
+
+import (
+	"context"
+	"errors"
+	lua "github.com/yuin/gopher-lua"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const playersPayload = `return {
+  {
+    colour="DAC6E9",
+    eventlevel=0,
+    name="小明",
+    netid="76561198012345678",
+    prefab="wilson"
+  },
+  {
+    colour="80CCE6",
+    eventlevel=-1,
+    name="Kirby",
+    netid="76561198087654321",
+    prefab="wendy"
+  }
+}`
+
+func TestDecodePlayers(t *testing.T) {
+	players, err := parsePlayersInfo(context.Background(), defaultDecoder, playersPayload)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(players) != 2 || players[0].Name != "小明" || players[1].Prefab != "wendy" || players[1].Level != -1 {
+		t.Errorf("unexpected players: %+v", players)
+	}
+}
+
+func TestDecodeDays(t *testing.T) {
+	var details ServerDetails
+	err := parsedDaysInfo(context.Background(), defaultDecoder, "return { day=23, dayselapsedinseason=2, daysleftinseason=18 }", &details)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if details.Details.Day != 23 || details.Details.DayElapsedInSeason != 2 || details.Details.DaysLeftInSeason != 18 {
+		t.Errorf("unexpected details: %+v", details.Details)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	samples := []struct {
+		name    string
+		decoder *LuaDecoder
+		payload string
+		err     error
+	}{
+		{"loop", defaultDecoder, "while true do end return {}", ErrPayloadNotAllowed},
+		{"call", defaultDecoder, "return { day = os.exit() }", ErrPayloadNotAllowed},
+		{"function", defaultDecoder, "return { day = function() end }", ErrPayloadNotAllowed},
+		{"global", defaultDecoder, "x = 1 return {}", ErrPayloadNotAllowed},
+		{"concat", defaultDecoder, `return { day = "a" .. "b" }`, ErrPayloadNotAllowed},
+		{"size", NewLuaDecoder(WithMaxPayloadSize(10)), "return { day = 1 }", ErrPayloadTooLarge},
+		{"instructions", NewLuaDecoder(WithMaxInstructions(10)), "return {" + strings.Repeat("{},", 100) + "}", ErrTooManyInstructions},
+		{"type", defaultDecoder, `return "not a table"`, ErrUnexpectedType},
+		{"field type", defaultDecoder, `return { day = "23" }`, ErrUnexpectedType},
+	}
+
+	for _, sample := range samples {
+		t.Run(sample.name, func(t *testing.T) {
+			var details ServerDetails
+			err := parsedDaysInfo(context.Background(), sample.decoder, sample.payload, &details)
+			if !errors.Is(err, sample.err) {
+				t.Errorf("expected %v, got %v", sample.err, err)
+				return
+			}
+
+			var decodeErr *DecodeError
+			if !errors.As(err, &decodeErr) || decodeErr.Field != "data" {
+				t.Errorf("expected DecodeError of data, got %#v", err)
+			}
+		})
+	}
+}
+
+func TestDecodeSyntaxError(t *testing.T) {
+	_, err := parsePlayersInfo(context.Background(), defaultDecoder, "return { {name=")
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) {
+		t.Errorf("expected DecodeError, got %v", err)
+	}
+}
+
+func TestDecodeMalformedPlayers(t *testing.T) {
+	_, err := parsePlayersInfo(context.Background(), defaultDecoder, `return { "wilson", { name = { } } }`)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !errors.Is(err, ErrUnexpectedType) {
+		t.Errorf("expected DecodeError, got %v", err)
+		return
+	}
+	t.Log(err)
+}
+
+func TestDecodeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := parsePlayersInfo(ctx, defaultDecoder, playersPayload)
+	if err == nil {
+		t.Error("error must be non-nil")
+	}
+}
+
+func TestDecodePanic(t *testing.T) {
+	d := NewLuaDecoder()
+
+	var states []*lua.LState
+	newState := d.pool.New
+	d.pool.New = func() any {
+		L := newState().(*lua.LState)
+		states = append(states, L)
+		return L
+	}
+
+	// nil context panics after the state is taken from pool
+	_, err := d.Decode(nil, "players", playersPayload)
+	if !errors.As(err, new(*DecodeError)) {
+		t.Errorf("expected DecodeError, got %v", err)
+		return
+	}
+	if len(states) != 1 || !states[0].IsClosed() {
+		t.Error("the state must be closed after panic")
+		return
+	}
+
+	players, err := parsePlayersInfo(context.Background(), d, playersPayload)
+	if err != nil || len(players) != 2 {
+		t.Errorf("unexpected result: %v %v", players, err)
+		return
+	}
+	if len(states) != 2 {
+		t.Errorf("expected a fresh state, got %d states created", len(states))
+	}
+}
+
+func TestDecodeConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				players, err := parsePlayersInfo(context.Background(), defaultDecoder, playersPayload)
+				if err != nil || len(players) != 2 {
+					t.Errorf("unexpected result: %v %v", players, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkDecodePlayers(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		parsePlayersInfo(context.Background(), defaultDecoder, playersPayload)
+	}
+}
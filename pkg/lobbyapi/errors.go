@@ -0,0 +1,138 @@
+package lobbyapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/go-resty/resty/v2"
+	"net/http"
+	"strings"
+)
+
+// sentinel errors, use errors.Is to check the kind of error returned by Client
+var (
+	// ErrTokenRequired means that klei token is not provided
+	ErrTokenRequired = errors.New("klei token is required")
+	// ErrTokenRejected means that klei token is invalid or expired
+	ErrTokenRejected = errors.New("klei token rejected")
+	// ErrRegionNotFound means that the region or region-platform pair does not exist
+	ErrRegionNotFound = errors.New("region not found")
+	// ErrServerNotFound means that no server matched the given rowId
+	ErrServerNotFound = errors.New("server not found")
+	// ErrRateLimited means that the request is limited by klei
+	ErrRateLimited = errors.New("rate limited")
+	// ErrServerDown means that the lobby server is unreachable or responds with 5xx
+	ErrServerDown = errors.New("lobby server unavailable")
+	// ErrUnexpectedStatus means that the lobby server responds with an unknown status code
+	ErrUnexpectedStatus = errors.New("unexpected status")
+)
+
+// Error is returned by Client when the request failed, it carries the request information
+type Error struct {
+	// http status code, 0 if no response received
+	StatusCode int
+	Region     string
+	Platform   string
+	URL        string
+	// response body
+	Body string
+
+	// Kind is one of the sentinel errors
+	Kind error
+	// Cause is the underlying transport error if no response received
+	Cause error
+}
+
+func (e *Error) Error() string {
+	var sb strings.Builder
+	sb.WriteString("lobbyapi: ")
+	if e.Kind != nil {
+		sb.WriteString(e.Kind.Error())
+	} else {
+		sb.WriteString("request failed")
+	}
+
+	if e.StatusCode != 0 {
+		fmt.Fprintf(&sb, " status=%d", e.StatusCode)
+	}
+	if e.Region != "" {
+		fmt.Fprintf(&sb, " region=%s", e.Region)
+	}
+	if e.Platform != "" {
+		fmt.Fprintf(&sb, " platform=%s", e.Platform)
+	}
+	if e.URL != "" {
+		fmt.Fprintf(&sb, " url=%s", e.URL)
+	}
+
+	if e.Cause != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Cause.Error())
+	} else if body := strings.TrimSpace(e.Body); body != "" {
+		sb.WriteString(": ")
+		sb.WriteString(body)
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() []error {
+	var errs []error
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	return errs
+}
+
+// StatusCodeOf returns the http status code carried by err, returns 0 if not found
+func StatusCodeOf(err error) int {
+	var lobbyErr *Error
+	if errors.As(err, &lobbyErr) {
+		return lobbyErr.StatusCode
+	}
+	return 0
+}
+
+// newTransportError wraps the error occurred before response received
+func newTransportError(cause error, url, region, platform string) error {
+	e := &Error{Region: region, Platform: platform, URL: url, Cause: cause}
+	// canceled by caller, it is not the fault of lobby server
+	if !errors.Is(cause, context.Canceled) && !errors.Is(cause, context.DeadlineExceeded) {
+		e.Kind = ErrServerDown
+	}
+	return e
+}
+
+// newStatusError classifies the non-200 response into typed error
+func newStatusError(response *resty.Response, region, platform string) error {
+	e := &Error{
+		StatusCode: response.StatusCode(),
+		Region:     region,
+		Platform:   platform,
+		URL:        response.Request.URL,
+		Body:       string(response.Body()),
+	}
+
+	// details api is the only one that requires token
+	withToken := response.Request.Method == http.MethodPost
+
+	switch code := e.StatusCode; {
+	case code == http.StatusUnauthorized:
+		e.Kind = ErrTokenRejected
+	case code == http.StatusForbidden && withToken:
+		e.Kind = ErrTokenRejected
+	// cdn responds 403 for the files that do not exist
+	case code == http.StatusForbidden, code == http.StatusNotFound:
+		e.Kind = ErrRegionNotFound
+	case code == http.StatusTooManyRequests:
+		e.Kind = ErrRateLimited
+	case code >= http.StatusInternalServerError:
+		e.Kind = ErrServerDown
+	default:
+		e.Kind = ErrUnexpectedStatus
+	}
+
+	return e
+}
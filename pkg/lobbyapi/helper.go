@@ -2,8 +2,11 @@ package lobbyapi
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	lua "github.com/yuin/gopher-lua"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -21,126 +24,356 @@ func parseURL(url string, params map[string]any) (string, error) {
 	return buff.String(), nil
 }
 
-func parsedLuaDetails(details ServerDetails) (ServerDetails, error) {
+func parsedLuaDetails(ctx context.Context, decoder *LuaDecoder, details ServerDetails) (ServerDetails, error) {
 
 	// days info
-	err := parsedDaysInfo(details.Data, &details)
+	err := parsedDaysInfo(ctx, decoder, details.Data, &details)
 	if err != nil {
 		return ServerDetails{}, err
 	}
 
 	// player info
-	playersInfo, err := parsePlayersInfo(details.OnlinePlayers)
+	playersInfo, err := parsePlayersInfo(ctx, decoder, details.OnlinePlayers)
 	if err != nil {
 		return ServerDetails{}, err
 	}
 	details.Details.Players = playersInfo
 
-	// mods info
-	details.Details.Mods = parseModsInfo(details.Mods)
+	// mods info, malformed entries will not fail the whole details
+	mods, modsErrs := parseModsInfo(details.Mods)
+	details.Details.Mods = mods
+	for _, err := range modsErrs {
+		details.Details.ModsErrors = append(details.Details.ModsErrors, err.Error())
+	}
+
+	// world generation info
+	worldGen, err := parseWorldGen(ctx, decoder, details.WorldGen)
+	if err != nil {
+		return ServerDetails{}, err
+	}
+	details.Details.WorldGen = worldGen
 
 	return details, nil
 }
 
 // parse days info from lua script
-func parsedDaysInfo(luaScript string, details *ServerDetails) error {
+func parsedDaysInfo(ctx context.Context, decoder *LuaDecoder, luaScript string, details *ServerDetails) error {
 	if details == nil {
 		return errors.New("nil details")
 	}
 
-	L := lua.NewState()
-	defer L.Close()
-	if err := L.DoString(luaScript); err != nil {
+	if luaScript == "" {
+		return nil
+	}
+
+	table, err := decoder.DecodeTable(ctx, "data", luaScript)
+	if err != nil {
 		return err
 	}
 
-	table := L.Get(-1).(*lua.LTable)
-	L.Pop(1)
-	details.Details.Day = int(table.RawGetString("day").(lua.LNumber))
-	details.Details.DayElapsedInSeason = int(table.RawGetString("dayselapsedinseason").(lua.LNumber))
-	details.Details.DaysLeftInSeason = int(table.RawGetString("daysleftinseason").(lua.LNumber))
+	if details.Details.Day, err = luaInt(table.RawGetString("day"), "data", ".day"); err != nil {
+		return err
+	}
+	if details.Details.DayElapsedInSeason, err = luaInt(table.RawGetString("dayselapsedinseason"), "data", ".dayselapsedinseason"); err != nil {
+		return err
+	}
+	if details.Details.DaysLeftInSeason, err = luaInt(table.RawGetString("daysleftinseason"), "data", ".daysleftinseason"); err != nil {
+		return err
+	}
 
 	return nil
 }
 
 // parse players info from lua script
-func parsePlayersInfo(luaScript string) ([]Player, error) {
-	L := lua.NewState()
-	defer L.Close()
-	if err := L.DoString(luaScript); err != nil {
+func parsePlayersInfo(ctx context.Context, decoder *LuaDecoder, luaScript string) ([]Player, error) {
+	if luaScript == "" {
+		return nil, nil
+	}
+
+	table, err := decoder.DecodeTable(ctx, "players", luaScript)
+	if err != nil {
 		return nil, err
 	}
 
 	var players []Player
 
-	table := L.Get(-1).(*lua.LTable)
-	table.ForEach(func(idx lua.LValue, value lua.LValue) {
-		playerTable := value.(*lua.LTable)
-		players = append(players, Player{
-			Name:    playerTable.RawGetString("name").String(),
-			Prefab:  playerTable.RawGetString("prefab").String(),
-			SteamId: playerTable.RawGetString("netid").String(),
-			Colour:  playerTable.RawGetString("colour").String(),
-			Level:   int(playerTable.RawGetString("eventlevel").(lua.LNumber)),
-		})
+	err = forEachTable(table, func(idx lua.LValue, value lua.LValue) error {
+		path := "[" + idx.String() + "]"
+		playerTable, err := luaTable(value, "players", path)
+		if err != nil || playerTable == nil {
+			return err
+		}
+
+		var player Player
+		if player.Name, err = luaString(playerTable.RawGetString("name"), "players", path+".name"); err != nil {
+			return err
+		}
+		if player.Prefab, err = luaString(playerTable.RawGetString("prefab"), "players", path+".prefab"); err != nil {
+			return err
+		}
+		if player.SteamId, err = luaString(playerTable.RawGetString("netid"), "players", path+".netid"); err != nil {
+			return err
+		}
+		if player.Colour, err = luaString(playerTable.RawGetString("colour"), "players", path+".colour"); err != nil {
+			return err
+		}
+		if player.Level, err = luaInt(playerTable.RawGetString("eventlevel"), "players", path+".eventlevel"); err != nil {
+			return err
+		}
+
+		players = append(players, player)
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
 
 	return players, nil
 }
 
-// parsed mods info from string slice, examples as follows:
-//  [
-//  	"workshop-374550642",
-//  	"Increased Stack size",
-//  	"1.62",
-//  	"1.62",
-//  	true,
-//  	"workshop-2798599672",
-//  	"六格装备栏（适配mod版）",
-//  	"4.6.8.f",
-//  	"4.6.8.f",
-//  	true,
-//  	"workshop-378160973",
-//  	"Global Positions",
-//  	"1.7.4",
-//  	"1.7.4",
-//  	true,
-//  ]
-
-func parseModsInfo(mods []any) []Mod {
-	if len(mods) == 0 {
-		return nil
+// parse world generation info from lua script, examples as follows:
+//
+//	return {
+//	  {
+//	    id="SURVIVAL_TOGETHER",
+//	    location="forest",
+//	    name="Default",
+//	    overrides={ autumn="longseason", carrots="often", task_set="default", world_size="huge", ... },
+//	    settings_id="SURVIVAL_TOGETHER",
+//	    version=4,
+//	    worldgen_id="SURVIVAL_TOGETHER",
+//	    ...
+//	  },
+//	  { id="DST_CAVE", location="cave", ... }
+//	}
+func parseWorldGen(ctx context.Context, decoder *LuaDecoder, luaScript string) (WorldGen, error) {
+	if luaScript == "" {
+		return WorldGen{}, nil
 	}
 
-	var res []Mod
+	table, err := decoder.DecodeTable(ctx, "worldgen", luaScript)
+	if err != nil {
+		return WorldGen{}, err
+	}
 
-	for i := 0; i < len(mods); i++ {
-		if strings.Contains(mods[i].(string), "workshop-") {
-			modId := strings.Split(mods[i].(string), "-")[1]
-			name := mods[i+1].(string)
-			v1 := mods[i+2].(string)
-			v2 := mods[i+3].(string)
-			enable := mods[i+4].(bool)
+	var worldGen WorldGen
+	err = forEachTable(table, func(idx lua.LValue, value lua.LValue) error {
+		path := "[" + idx.String() + "]"
+		shardTable, err := luaTable(value, "worldgen", path)
+		if err != nil || shardTable == nil {
+			return err
+		}
 
-			i = i + 4
+		shard := ShardWorldGen{Overrides: map[string]string{}}
+		strFields := []struct {
+			key string
+			dst *string
+		}{
+			{"location", &shard.Location},
+			{"id", &shard.Preset},
+			{"name", &shard.Name},
+			{"settings_id", &shard.SettingsPreset},
+			{"worldgen_id", &shard.WorldGenPreset},
+		}
+		for _, f := range strFields {
+			if *f.dst, err = luaString(shardTable.RawGetString(f.key), "worldgen", path+"."+f.key); err != nil {
+				return err
+			}
+		}
+		if shard.Version, err = luaInt(shardTable.RawGetString("version"), "worldgen", path+".version"); err != nil {
+			return err
+		}
 
-			res = append(res, Mod{
-				Id:       modId,
-				Name:     name,
-				Version1: v1,
-				Version2: v2,
-				Enabled:  enable,
+		overrides, err := luaTable(shardTable.RawGetString("overrides"), "worldgen", path+".overrides")
+		if err != nil {
+			return err
+		}
+		if overrides != nil {
+			err = forEachTable(overrides, func(key lua.LValue, value lua.LValue) error {
+				// nested overrides are not supported
+				v, err := luaString(value, "worldgen", path+".overrides."+key.String())
+				if err != nil {
+					return err
+				}
+				shard.Overrides[key.String()] = v
+				return nil
 			})
+			if err != nil {
+				return err
+			}
+		}
+
+		shard.TaskSet = shard.Overrides["task_set"]
+		shard.WorldSize = shard.Overrides["world_size"]
+		shard.StartLocation = shard.Overrides["start_location"]
+		shard.SeasonStart = shard.Overrides["season_start"]
+		shard.Seasons = Seasons{
+			Autumn: shard.Overrides["autumn"],
+			Winter: shard.Overrides["winter"],
+			Spring: shard.Overrides["spring"],
+			Summer: shard.Overrides["summer"],
 		}
+
+		worldGen.Shards = append(worldGen.Shards, shard)
+		return nil
+	})
+	if err != nil {
+		return WorldGen{}, err
+	}
+
+	return worldGen, nil
+}
+
+// forEachTable iterates the table until fn returns error
+func forEachTable(table *lua.LTable, fn func(key, value lua.LValue) error) error {
+	var err error
+	table.ForEach(func(key lua.LValue, value lua.LValue) {
+		if err == nil {
+			err = fn(key, value)
+		}
+	})
+	return err
+}
+
+// WorkshopPrefix is the prefix of workshop mod name
+const WorkshopPrefix = "workshop-"
+
+// modTupleSize is the number of elements of single mod in mods_info
+const modTupleSize = 5
+
+// parsed mods info from flat slice, every 5 elements make up a mod:
+// name, fancy name, version, version_compatible, enabled. Examples as follows:
+//
+//	[
+//		"workshop-374550642",
+//		"Increased Stack size",
+//		"1.62",
+//		"1.62",
+//		true,
+//		"workshop-2798599672",
+//		"六格装备栏（适配mod版）",
+//		"4.6.8.f",
+//		"4.6.8.f",
+//		true,
+//		"my-local-mod",
+//		"My Local Mod",
+//		"1.0",
+//		"1.0",
+//		true,
+//	]
+//
+// Malformed entries are skipped until the next valid tuple, and reported by the returned errors.
+func parseModsInfo(mods []any) ([]Mod, []error) {
+	if len(mods) == 0 {
+		return nil, nil
+	}
+
+	var (
+		res  []Mod
+		errs []error
+	)
+
+	for i := 0; i < len(mods); {
+		mod, err := parseModTuple(mods, i)
+		if err != nil {
+			errs = append(errs, err)
+			// resync to the next valid tuple
+			i++
+			for i < len(mods) {
+				if _, err := parseModTuple(mods, i); err == nil {
+					break
+				}
+				i++
+			}
+			continue
+		}
+
+		res = append(res, mod)
+		i += modTupleSize
 	}
 
-	return res
+	return res, errs
 }
 
+// parseModTuple parses the mod tuple starts at index i
+func parseModTuple(mods []any, i int) (Mod, error) {
+	tupleErr := func(format string, args ...any) error {
+		return &DecodeError{Field: "mods_info", Path: fmt.Sprintf("[%d]", i), Err: fmt.Errorf(format, args...)}
+	}
+
+	if i+modTupleSize > len(mods) {
+		return Mod{}, tupleErr("incomplete mod tuple, %d elements remained", len(mods)-i)
+	}
+
+	var fields [modTupleSize - 1]string
+	for j := range fields {
+		switch v := mods[i+j].(type) {
+		case string:
+			fields[j] = v
+		// some versions are reported as number
+		case float64:
+			if j < 2 {
+				return Mod{}, tupleErr("%w: expected string at offset %d, got number", ErrUnexpectedType, j)
+			}
+			fields[j] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return Mod{}, tupleErr("%w: expected string at offset %d, got %T", ErrUnexpectedType, j, v)
+		}
+	}
+
+	enabled, ok := mods[i+modTupleSize-1].(bool)
+	if !ok {
+		return Mod{}, tupleErr("%w: expected bool at offset %d, got %T", ErrUnexpectedType, modTupleSize-1, mods[i+modTupleSize-1])
+	}
+
+	if fields[0] == "" {
+		return Mod{}, tupleErr("empty mod name")
+	}
+
+	mod := Mod{
+		Id:                fields[0],
+		Name:              fields[1],
+		Version:           fields[2],
+		VersionCompatible: fields[3],
+		Enabled:           enabled,
+	}
+
+	if id, found := strings.CutPrefix(fields[0], WorkshopPrefix); found {
+		mod.Id = id
+		mod.Workshop = true
+	}
+
+	return mod, nil
+}
+
+// PlatformDisplayName returns the platform name displayed to users
 func PlatformDisplayName(region string, platform Platform) string {
 	// WeGame only supported in CN
 	if region == ApEast && platform == Rail {
-		return "WeGame"
+		return WeGame
 	}
 	return platform.String()
 }
+
+// PlatformOf returns the platform and its display name that the option refers to,
+// returns false if option is AllPlatforms or unknown.
+func PlatformOf(option PlatformOption) (Platform, string, bool) {
+	var platform Platform
+	switch option {
+	case SteamOption:
+		platform = Steam
+	case WeGameOption:
+		return Rail, PlatformDisplayName(ApEast, Rail), true
+	case PSNOption:
+		platform = PSN
+	case XboxOption:
+		platform = XBOne
+	case PS4OfficialOption:
+		platform = PS4Official
+	case SwitchOption:
+		platform = Switch
+	default:
+		return 0, "", false
+	}
+	return platform, platform.String(), true
+}
@@ -0,0 +1,179 @@
+package lobbyapi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParsedURL(t *testing.T) {
+	url, err := parseURL(LobbyServersURL, map[string]any{
+		"region":   "ap-east-1",
+		"platform": "Steam",
+	})
+
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if url != "https://lobby-v2-cdn.klei.com/ap-east-1-Steam.json.gz" {
+		t.Error("Invalid")
+		return
+	}
+
+	t.Log(url)
+}
+
+func TestParseWorldGen(t *testing.T) {
+	script := `return {
+  {
+    id="SURVIVAL_TOGETHER",
+    location="forest",
+    name="Default",
+    overrides={
+      autumn="longseason",
+      carrots="often",
+      hounds="never",
+      rock="mostly",
+      season_start="winter",
+      start_location="default",
+      summer="noseason",
+      task_set="default",
+      world_size="huge"
+    },
+    settings_id="SURVIVAL_TOGETHER",
+    version=4,
+    worldgen_id="SURVIVAL_TOGETHER"
+  },
+  {
+    id="DST_CAVE",
+    location="cave",
+    overrides={ task_set="cave_default", wormlights="often" },
+    version=4
+  }
+}`
+
+	worldGen, err := parseWorldGen(context.Background(), defaultDecoder, script)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(worldGen.Shards) != 2 {
+		t.Errorf("expected 2 shards, got %d", len(worldGen.Shards))
+		return
+	}
+
+	forest, ok := worldGen.Shard("forest")
+	if !ok {
+		t.Error("forest shard not found")
+		return
+	}
+	if forest.Preset != "SURVIVAL_TOGETHER" || forest.Version != 4 || forest.WorldSize != "huge" ||
+		forest.SeasonStart != "winter" || forest.Seasons.Autumn != "longseason" || forest.Seasons.Summer != "noseason" {
+		t.Errorf("unexpected forest shard: %+v", forest)
+	}
+	if forest.Overrides["carrots"] != "often" || forest.Overrides["rock"] != "mostly" || forest.Overrides["hounds"] != "never" {
+		t.Errorf("unexpected overrides: %v", forest.Overrides)
+	}
+
+	cave, ok := worldGen.Shard("cave")
+	if !ok || cave.TaskSet != "cave_default" || cave.Overrides["wormlights"] != "often" {
+		t.Errorf("unexpected cave shard: %+v", cave)
+	}
+}
+
+func TestParseModsInfo(t *testing.T) {
+	samples := []struct {
+		name   string
+		mods   []any
+		expect []Mod
+		errs   int
+	}{
+		{
+			name:   "empty",
+			mods:   nil,
+			expect: nil,
+		},
+		{
+			name: "workshop",
+			mods: []any{
+				"workshop-374550642", "Increased Stack size", "1.62", "1.62", true,
+				"workshop-2798599672", "六格装备栏（适配mod版）", "4.6.8.f", "4.6.8.f", true,
+			},
+			expect: []Mod{
+				{Id: "374550642", Name: "Increased Stack size", Version: "1.62", VersionCompatible: "1.62", Enabled: true, Workshop: true},
+				{Id: "2798599672", Name: "六格装备栏（适配mod版）", Version: "4.6.8.f", VersionCompatible: "4.6.8.f", Enabled: true, Workshop: true},
+			},
+		},
+		{
+			name: "local",
+			mods: []any{
+				"my-local-mod", "My Local Mod", "1.0", "0.9", false,
+				"workshop-378160973", "Global Positions", "1.7.4", "1.7.4", true,
+			},
+			expect: []Mod{
+				{Id: "my-local-mod", Name: "My Local Mod", Version: "1.0", VersionCompatible: "0.9", Enabled: false},
+				{Id: "378160973", Name: "Global Positions", Version: "1.7.4", VersionCompatible: "1.7.4", Enabled: true, Workshop: true},
+			},
+		},
+		{
+			name: "numeric version",
+			mods: []any{"workshop-1", "Numeric", 1.5, float64(2), true},
+			expect: []Mod{
+				{Id: "1", Name: "Numeric", Version: "1.5", VersionCompatible: "2", Enabled: true, Workshop: true},
+			},
+		},
+		{
+			name: "truncated",
+			mods: []any{
+				"workshop-374550642", "Increased Stack size", "1.62", "1.62", true,
+				"workshop-378160973", "Global Positions", "1.7.4",
+			},
+			expect: []Mod{
+				{Id: "374550642", Name: "Increased Stack size", Version: "1.62", VersionCompatible: "1.62", Enabled: true, Workshop: true},
+			},
+			errs: 1,
+		},
+		{
+			name: "malformed in middle",
+			mods: []any{
+				"workshop-374550642", "Increased Stack size", nil, "1.62", true,
+				"workshop-378160973", "Global Positions", "1.7.4", "1.7.4", true,
+			},
+			expect: []Mod{
+				{Id: "378160973", Name: "Global Positions", Version: "1.7.4", VersionCompatible: "1.7.4", Enabled: true, Workshop: true},
+			},
+			errs: 1,
+		},
+		{
+			name: "missing enabled",
+			mods: []any{
+				"workshop-374550642", "Increased Stack size", "1.62", "1.62",
+				"workshop-378160973", "Global Positions", "1.7.4", "1.7.4", true,
+			},
+			expect: []Mod{
+				{Id: "378160973", Name: "Global Positions", Version: "1.7.4", VersionCompatible: "1.7.4", Enabled: true, Workshop: true},
+			},
+			errs: 1,
+		},
+		{
+			name: "garbage",
+			mods: []any{true, 1.0, map[string]any{}, []any{}},
+			errs: 1,
+		},
+	}
+
+	for _, sample := range samples {
+		t.Run(sample.name, func(t *testing.T) {
+			mods, errs := parseModsInfo(sample.mods)
+			if len(errs) != sample.errs {
+				t.Errorf("expected %d errors, got %v", sample.errs, errs)
+			}
+			if !reflect.DeepEqual(mods, sample.expect) {
+				t.Errorf("expected %+v, got %+v", sample.expect, mods)
+			}
+		})
+	}
+}
@@ -1,38 +1,105 @@
 package lobbyapi
 
 import (
-	"errors"
+	"context"
 	"github.com/bytedance/sonic"
 	"github.com/go-resty/resty/v2"
 	"net/http"
 )
 
+// Option configures the lobby Client
+type Option func(c *Client)
+
+// WithRegionURL replaces the url of regions api, empty url will be ignored
+func WithRegionURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.regionURL = url
+		}
+	}
+}
+
+// WithServersURL replaces the url template of servers api, empty url will be ignored.
+// template params {{.region}} and {{.platform}} are available.
+func WithServersURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.serversURL = url
+		}
+	}
+}
+
+// WithDetailsURL replaces the url template of details api, empty url will be ignored.
+// template params {{.region}} is available.
+func WithDetailsURL(url string) Option {
+	return func(c *Client) {
+		if url != "" {
+			c.detailsURL = url
+		}
+	}
+}
+
+// WithLuaDecoder replaces the decoder of lua payloads in server details
+func WithLuaDecoder(decoder *LuaDecoder) Option {
+	return func(c *Client) {
+		if decoder != nil {
+			c.decoder = decoder
+		}
+	}
+}
+
 // New returns a new instance of lobby client with klei token
-func New(token string) *Client {
-	return &Client{client: resty.New(), token: token}
+func New(token string, options ...Option) *Client {
+	return NewWith(token, resty.New(), options...)
 }
 
-func NewWith(token string, client *resty.Client) *Client {
-	return &Client{client: client, token: token}
+// NewWith returns a new instance of lobby client with klei token and the given resty client
+func NewWith(token string, client *resty.Client, options ...Option) *Client {
+	c := &Client{
+		client:     client,
+		token:      token,
+		regionURL:  LobbyRegionURL,
+		serversURL: LobbyServersURL,
+		detailsURL: LobbyDetailsURL,
+		decoder:    defaultDecoder,
+	}
+
+	for _, option := range options {
+		option(c)
+	}
+
+	return c
 }
 
 // Client is dst lobby http client, interact with lobby server and returns server information
 type Client struct {
 	client *resty.Client
 	token  string
+
+	// lobby endpoints
+	regionURL  string
+	serversURL string
+	detailsURL string
+
+	decoder *LuaDecoder
 }
 
 // GetCapableRegions returns a list of available regions that can be used in other api
 // GET https://lobby-v2-cdn.klei.com/regioncapabilities-v2.json
 func (c *Client) GetCapableRegions() (Regions, error) {
-	response, err := c.client.R().Get(LobbyRegionURL)
+	return c.GetCapableRegionsWithContext(context.Background())
+}
+
+// GetCapableRegionsWithContext is the same as GetCapableRegions, the request will be aborted once ctx is done
+func (c *Client) GetCapableRegionsWithContext(ctx context.Context) (Regions, error) {
+	response, err := c.client.R().SetContext(ctx).Get(c.regionURL)
 	if err != nil {
-		return Regions{}, err
+		return Regions{}, newTransportError(err, c.regionURL, "", "")
 	}
 
 	// request failed
 	if response.StatusCode() != http.StatusOK {
-		return Regions{}, errors.New(string(response.Body()))
+		return Regions{}, newStatusError(response, "", "")
 	}
 
 	var regions Regions
@@ -45,7 +112,12 @@ func (c *Client) GetCapableRegions() (Regions, error) {
 // GetLobbyServers returns a list of lobby servers with specified region and platform
 // GET https://lobby-v2-cdn.klei.com/{region}-{platform}.json.gz
 func (c *Client) GetLobbyServers(region string, platform string) (Servers, error) {
-	url, err := parseURL(LobbyServersURL, map[string]any{
+	return c.GetLobbyServersWithContext(context.Background(), region, platform)
+}
+
+// GetLobbyServersWithContext is the same as GetLobbyServers, the request will be aborted once ctx is done
+func (c *Client) GetLobbyServersWithContext(ctx context.Context, region string, platform string) (Servers, error) {
+	url, err := parseURL(c.serversURL, map[string]any{
 		"region":   region,
 		"platform": platform,
 	})
@@ -53,14 +125,14 @@ func (c *Client) GetLobbyServers(region string, platform string) (Servers, error
 		return Servers{}, err
 	}
 
-	response, err := c.client.R().Get(url)
+	response, err := c.client.R().SetContext(ctx).Get(url)
 	if err != nil {
-		return Servers{}, err
+		return Servers{}, newTransportError(err, url, region, platform)
 	}
 
 	// request failed
 	if response.StatusCode() != http.StatusOK {
-		return Servers{}, errors.New(string(response.Body()))
+		return Servers{}, newStatusError(response, region, platform)
 	}
 
 	var servers Servers
@@ -74,7 +146,12 @@ func (c *Client) GetLobbyServers(region string, platform string) (Servers, error
 // GetServerDetails returns the details information for the specified server by rowId
 // POST https://lobby-v2-{region}.klei.com/lobby/read
 func (c *Client) GetServerDetails(region string, rowId string) (ServerDetails, error) {
-	url, err := parseURL(LobbyDetailsURL, map[string]any{
+	return c.GetServerDetailsWithContext(context.Background(), region, rowId)
+}
+
+// GetServerDetailsWithContext is the same as GetServerDetails, the request will be aborted once ctx is done
+func (c *Client) GetServerDetailsWithContext(ctx context.Context, region string, rowId string) (ServerDetails, error) {
+	url, err := parseURL(c.detailsURL, map[string]any{
 		"region": region,
 	})
 	if err != nil {
@@ -82,7 +159,7 @@ func (c *Client) GetServerDetails(region string, rowId string) (ServerDetails, e
 	}
 
 	if len(c.token) == 0 {
-		return ServerDetails{}, errors.New("klei token is required")
+		return ServerDetails{}, ErrTokenRequired
 	}
 
 	// prepare query body
@@ -100,14 +177,14 @@ func (c *Client) GetServerDetails(region string, rowId string) (ServerDetails, e
 	}
 
 	// send request
-	response, err := c.client.R().SetBody(bytes).Post(url)
+	response, err := c.client.R().SetContext(ctx).SetBody(bytes).Post(url)
 	if err != nil {
-		return ServerDetails{}, err
+		return ServerDetails{}, newTransportError(err, url, region, "")
 	}
 
 	// request failed
 	if response.StatusCode() != http.StatusOK {
-		return ServerDetails{}, errors.New(string(response.Body()))
+		return ServerDetails{}, newStatusError(response, region, "")
 	}
 
 	var detailResp struct {
@@ -118,10 +195,10 @@ func (c *Client) GetServerDetails(region string, rowId string) (ServerDetails, e
 		return ServerDetails{}, err
 	}
 
-	if len(detailResp.List) > 0 {
-		details := detailResp.List[0]
-		// parse lua script
-		return parsedLuaDetails(details)
+	if len(detailResp.List) == 0 {
+		return ServerDetails{}, &Error{Region: region, URL: url, Kind: ErrServerNotFound}
 	}
-	return ServerDetails{}, nil
+
+	// parse lua script
+	return parsedLuaDetails(ctx, c.decoder, detailResp.List[0])
 }
@@ -1,66 +1,206 @@
-package lobbyapi
+package lobbyapi_test
 
 import (
+	"context"
 	"errors"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"github.com/dstgo/tracker/pkg/lobbyapi/lobbytest"
+	"net/http"
 	"testing"
 )
 
 func TestLobbyRegions(t *testing.T) {
-	client := New("")
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
 	regions, err := client.GetCapableRegions()
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	if len(regions.Regions) != 4 {
+		t.Errorf("expected 4 regions, got %d", len(regions.Regions))
+		return
+	}
 	t.Log(regions)
 }
 
 func TestLobbyServersOk(t *testing.T) {
-	client := New("")
-	servers, err := client.GetLobbyServers("ap-east-1", Steam.String())
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
+	servers, err := client.GetLobbyServers("ap-east-1", lobbyapi.Steam.String())
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	if len(servers.List) != 2 {
+		t.Errorf("expected 2 servers, got %d", len(servers.List))
+		return
+	}
+	if servers.List[0].Secondaries["Caves"].Port != 10998 {
+		t.Errorf("unexpected secondaries: %v", servers.List[0].Secondaries)
+		return
+	}
 	t.Log(servers)
 }
 
+func TestLobbyServersEmpty(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
+	servers, err := client.GetLobbyServers("eu-central-1", lobbyapi.Switch.String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(servers.List) != 0 {
+		t.Errorf("expected empty list, got %d", len(servers.List))
+	}
+}
+
 func TestLobbyServersFailed(t *testing.T) {
-	client := New("")
-	servers, err := client.GetLobbyServers("unknown", Steam.String())
-	if err == nil {
-		t.Error(errors.New("error must be non-nil"))
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
+	servers, err := client.GetLobbyServers("unknown", lobbyapi.Steam.String())
+	if !errors.Is(err, lobbyapi.ErrRegionNotFound) {
+		t.Errorf("expected ErrRegionNotFound, got %v", err)
+		return
+	}
+
+	var lobbyErr *lobbyapi.Error
+	if !errors.As(err, &lobbyErr) || lobbyErr.Region != "unknown" || lobbyErr.Platform != "Steam" || lobbyErr.StatusCode != 404 {
+		t.Errorf("unexpected error: %#v", err)
 		return
 	}
 	t.Log(servers)
 	t.Log(err)
 }
 
+func TestLobbyServersDown(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+	lobby.SetStatus("/ap-east-1-Steam.json.gz", http.StatusServiceUnavailable)
+
+	client := lobby.Client("")
+	_, err := client.GetLobbyServers("ap-east-1", lobbyapi.Steam.String())
+	if !errors.Is(err, lobbyapi.ErrServerDown) {
+		t.Errorf("expected ErrServerDown, got %v", err)
+		return
+	}
+	if lobbyapi.StatusCodeOf(err) != http.StatusServiceUnavailable {
+		t.Errorf("unexpected status code: %d", lobbyapi.StatusCodeOf(err))
+	}
+}
+
+func TestLobbyServersCanceled(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := client.GetLobbyServersWithContext(ctx, "ap-east-1", lobbyapi.Steam.String())
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+		return
+	}
+}
+
 func TestServerDetails(t *testing.T) {
-	client := New("klei Token")
-	servers, err := client.GetServerDetails("ap-east-1", "KU_nnMF5SAo")
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+	lobby.Token = "klei Token"
+
+	client := lobby.Client("klei Token")
+	details, err := client.GetServerDetails("ap-east-1", "KU_nnMF5SAo")
 	if err != nil {
 		t.Error(err)
 		return
 	}
-	t.Log(servers)
+	if details.Details.Day != 23 || len(details.Details.Players) != 2 || len(details.Details.Mods) != 3 {
+		t.Errorf("unexpected details: %+v", details.Details)
+		return
+	}
+	if forest, ok := details.Details.WorldGen.Shard("forest"); !ok || forest.WorldSize != "huge" {
+		t.Errorf("unexpected worldgen: %+v", details.Details.WorldGen)
+		return
+	}
+	t.Log(details)
 }
 
-func TestParsedURL(t *testing.T) {
-	url, err := parseURL(LobbyServersURL, map[string]any{
-		"region":   "ap-east-1",
-		"platform": "Steam",
-	})
+func TestServerDetailsTokenRejected(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+	lobby.Token = "klei Token"
 
-	if err != nil {
-		t.Error(err)
+	client := lobby.Client("expired Token")
+	_, err := client.GetServerDetails("ap-east-1", "KU_nnMF5SAo")
+	if !errors.Is(err, lobbyapi.ErrTokenRejected) {
+		t.Errorf("expected ErrTokenRejected, got %v", err)
 		return
 	}
+	t.Log(err)
+}
+
+func TestServerDetailsTokenRequired(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("")
+	_, err := client.GetServerDetails("ap-east-1", "KU_nnMF5SAo")
+	if !errors.Is(err, lobbyapi.ErrTokenRequired) {
+		t.Errorf("expected ErrTokenRequired, got %v", err)
+	}
+}
+
+func TestServerDetailsNotFound(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("klei Token")
+	_, err := client.GetServerDetails("ap-east-1", "KU_notexists")
+	if !errors.Is(err, lobbyapi.ErrServerNotFound) {
+		t.Errorf("expected ErrServerNotFound, got %v", err)
+	}
+}
+
+func TestServerDetailsBatch(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobby.Client("klei Token")
+	queries := []lobbyapi.DetailsQuery{
+		{Region: "ap-east-1", RowId: "KU_nnMF5SAo"},
+		{Region: "ap-east-1", RowId: "KU_notexists"},
+		{Region: "unknown", RowId: "KU_nnMF5SAo"},
+		{Region: "ap-east-1", RowId: "KU_nnMF5SAo"},
+	}
 
-	if url != "https://lobby-v2-cdn.klei.com/ap-east-1-Steam.json.gz" {
-		t.Error("Invalid")
+	results := client.GetServerDetailsBatch(context.Background(), queries, 2)
+	if len(results) != len(queries) {
+		t.Errorf("expected %d results, got %d", len(queries), len(results))
 		return
 	}
 
-	t.Log(url)
+	for i, result := range results {
+		if result.DetailsQuery != queries[i] {
+			t.Errorf("result %d is out of order: %+v", i, result.DetailsQuery)
+		}
+	}
+
+	if results[0].Err != nil || results[0].Details.Details.Day != 23 || results[3].Err != nil {
+		t.Errorf("unexpected results: %v %v", results[0].Err, results[3].Err)
+	}
+	if !errors.Is(results[1].Err, lobbyapi.ErrServerNotFound) {
+		t.Errorf("expected ErrServerNotFound, got %v", results[1].Err)
+	}
+	if !errors.Is(results[2].Err, lobbyapi.ErrRegionNotFound) {
+		t.Errorf("expected ErrRegionNotFound, got %v", results[2].Err)
+	}
 }
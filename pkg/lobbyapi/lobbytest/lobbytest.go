@@ -0,0 +1,320 @@
+// Package lobbytest provides a fake klei lobby server which serves recorded lobby data,
+// it is used to test lobby client and collection pipeline without network.
+package lobbytest
+
+import (
+	"bytes"
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"github.com/bytedance/sonic"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+)
+
+//go:embed fixtures/*.json
+var fixtures embed.FS
+
+// recorded fixtures, named as
+//
+//	regioncapabilities-v2.json
+//	{region}-{platform}.json
+//	lobby-read-{region}.json
+const regionsFixture = "fixtures/regioncapabilities-v2.json"
+
+// Server is a fake klei lobby server, it serves
+//
+//	GET  /regioncapabilities-v2.json
+//	GET  /{region}-{platform}.json.gz
+//	POST /{region}/lobby/read
+//
+// the server list is gzip compressed as klei cdn does.
+type Server struct {
+	*httptest.Server
+
+	// Token is required by details api if not empty
+	Token string
+
+	mu sync.RWMutex
+	// recorded json response, key is request path
+	regions []byte
+	servers map[string][]byte
+	details map[string][]lobbyapi.ServerDetails
+	// injected status codes, key is request path
+	status   map[string]int
+	failures map[string]*failure
+	// request counter, key is request path
+	requests map[string]int
+}
+
+// failure is a transient failure that will be responded n times
+type failure struct {
+	code       int
+	retryAfter string
+	n          int
+}
+
+// NewServer starts and returns a new fake lobby server loaded with recorded fixtures,
+// caller should call Close when finished.
+func NewServer() *Server {
+	s := NewEmptyServer()
+
+	regions, err := fixtures.ReadFile(regionsFixture)
+	if err != nil {
+		panic(err)
+	}
+	s.regions = regions
+
+	entries, err := fixtures.ReadDir("fixtures")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		content, err := fixtures.ReadFile(path.Join("fixtures", name))
+		if err != nil {
+			panic(err)
+		}
+
+		switch {
+		case name == path.Base(regionsFixture):
+			continue
+		case strings.HasPrefix(name, "lobby-read-"):
+			var detailResp struct {
+				List []lobbyapi.ServerDetails `json:"GET"`
+			}
+			if err := sonic.Unmarshal(content, &detailResp); err != nil {
+				panic(err)
+			}
+			region := strings.TrimSuffix(strings.TrimPrefix(name, "lobby-read-"), ".json")
+			s.details[region] = detailResp.List
+		default:
+			s.servers["/"+name+".gz"] = content
+		}
+	}
+
+	return s
+}
+
+// NewEmptyServer starts and returns a new fake lobby server without any data.
+func NewEmptyServer() *Server {
+	s := &Server{
+		regions:  []byte(`{"LobbyRegions":[]}`),
+		servers:  make(map[string][]byte),
+		details:  make(map[string][]lobbyapi.ServerDetails),
+		status:   make(map[string]int),
+		failures: make(map[string]*failure),
+		requests: make(map[string]int),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Options returns the lobby client options that direct all requests to this server
+func (s *Server) Options() []lobbyapi.Option {
+	return []lobbyapi.Option{
+		lobbyapi.WithRegionURL(s.URL + "/regioncapabilities-v2.json"),
+		lobbyapi.WithServersURL(s.URL + "/{{.region}}-{{.platform}}.json.gz"),
+		lobbyapi.WithDetailsURL(s.URL + "/{{.region}}/lobby/read"),
+	}
+}
+
+// Client returns a new lobby client that directs all requests to this server
+func (s *Server) Client(token string) *lobbyapi.Client {
+	return lobbyapi.New(token, s.Options()...)
+}
+
+// SetRegions replaces the capable regions
+func (s *Server) SetRegions(regions ...string) {
+	var resp lobbyapi.Regions
+	for _, region := range regions {
+		resp.Regions = append(resp.Regions, struct {
+			Region string `json:"Region"`
+		}{Region: region})
+	}
+
+	bs, err := sonic.Marshal(resp)
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	s.regions = bs
+	s.mu.Unlock()
+}
+
+// SetServers replaces the server list of the specified region and platform
+func (s *Server) SetServers(region, platform string, servers ...lobbyapi.Server) {
+	bs, err := sonic.Marshal(lobbyapi.Servers{List: servers})
+	if err != nil {
+		panic(err)
+	}
+
+	s.mu.Lock()
+	s.servers[fmt.Sprintf("/%s-%s.json.gz", region, platform)] = bs
+	s.mu.Unlock()
+}
+
+// SetDetails replaces the details list of the specified region
+func (s *Server) SetDetails(region string, details ...lobbyapi.ServerDetails) {
+	s.mu.Lock()
+	s.details[region] = details
+	s.mu.Unlock()
+}
+
+// SetStatus makes the server always respond the given status code for the request path,
+// status code 0 means to remove the injected status.
+func (s *Server) SetStatus(path string, code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if code == 0 {
+		delete(s.status, path)
+	} else {
+		s.status[path] = code
+	}
+}
+
+// SetFailures makes the server respond the given status code for the next n requests of the path,
+// Retry-After header will be set if retryAfter is not empty.
+func (s *Server) SetFailures(path string, code int, n int, retryAfter string) {
+	s.mu.Lock()
+	s.failures[path] = &failure{code: code, n: n, retryAfter: retryAfter}
+	s.mu.Unlock()
+}
+
+// Requests returns how many requests of the path has been received
+func (s *Server) Requests(path string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.requests[path]
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests[r.URL.Path]++
+	if f, ok := s.failures[r.URL.Path]; ok && f.n > 0 {
+		f.n--
+		s.mu.Unlock()
+		if f.retryAfter != "" {
+			w.Header().Set("Retry-After", f.retryAfter)
+		}
+		http.Error(w, http.StatusText(f.code), f.code)
+		return
+	}
+	s.mu.Unlock()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if code, ok := s.status[r.URL.Path]; ok {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/regioncapabilities-v2.json":
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(s.regions)
+	case r.Method == http.MethodGet && strings.HasSuffix(r.URL.Path, ".json.gz"):
+		s.serveServers(w, r)
+	case r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/lobby/read"):
+		s.serveDetails(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveServers(w http.ResponseWriter, r *http.Request) {
+	content, ok := s.servers[r.URL.Path]
+	if !ok {
+		// capable region without recorded data has an empty list
+		if !s.isCapable(r.URL.Path) {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		content = []byte(`{"GET":[]}`)
+	}
+
+	buf := bytes.NewBuffer(nil)
+	gzw := gzip.NewWriter(buf)
+	gzw.Write(content)
+	gzw.Close()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Encoding", "gzip")
+	w.Write(buf.Bytes())
+}
+
+func (s *Server) serveDetails(w http.ResponseWriter, r *http.Request) {
+	region := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/lobby/read")
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var query struct {
+		Token  string `json:"__token"`
+		GameId string `json:"__gameId"`
+		Query  struct {
+			RowId string `json:"__rowId"`
+		} `json:"query"`
+	}
+	if err := sonic.Unmarshal(body, &query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if s.Token != "" && query.Token != s.Token {
+		http.Error(w, `{"error":"AUTH_ERROR_E_EXPIRED_TOKEN"}`, http.StatusUnauthorized)
+		return
+	}
+
+	list, ok := s.details[region]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	resp := struct {
+		List []lobbyapi.ServerDetails `json:"GET"`
+	}{List: []lobbyapi.ServerDetails{}}
+
+	for _, details := range list {
+		if details.RowId == query.Query.RowId {
+			resp.List = append(resp.List, details)
+		}
+	}
+
+	bs, err := sonic.Marshal(resp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(bs)
+}
+
+// isCapable reports whether the region in path /{region}-{platform}.json.gz is capable
+func (s *Server) isCapable(urlPath string) bool {
+	var regions lobbyapi.Regions
+	if err := sonic.Unmarshal(s.regions, &regions); err != nil {
+		return false
+	}
+
+	name := strings.TrimSuffix(strings.TrimPrefix(urlPath, "/"), ".json.gz")
+	for _, region := range regions.Regions {
+		platform, found := strings.CutPrefix(name, region.Region+"-")
+		if found && !strings.Contains(platform, "-") {
+			return true
+		}
+	}
+	return false
+}
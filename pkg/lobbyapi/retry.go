@@ -0,0 +1,138 @@
+package lobbyapi
+
+import (
+	"context"
+	"errors"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/time/rate"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRetryMaxWaitTime caps the backoff and Retry-After if the policy does not specify one,
+// otherwise a large Retry-After would block the request for that long.
+const DefaultRetryMaxWaitTime = 10 * time.Second
+
+// RetryPolicy decides how to retry the failed requests, it retries on transport errors, 429 and 5xx.
+// The wait time grows exponentially with jitter, Retry-After header will be honored if present.
+type RetryPolicy struct {
+	// max retry times, 0 means no retry
+	Count int
+	// initial wait time of backoff
+	WaitTime time.Duration
+	// max wait time of backoff, Retry-After will be capped by it too, 0 means DefaultRetryMaxWaitTime
+	MaxWaitTime time.Duration
+}
+
+// WithRetry enables retry for the lobby client
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) {
+		if policy.Count <= 0 {
+			return
+		}
+
+		if policy.MaxWaitTime <= 0 {
+			policy.MaxWaitTime = DefaultRetryMaxWaitTime
+		}
+
+		c.client.
+			SetRetryCount(policy.Count).
+			SetRetryWaitTime(policy.WaitTime).
+			SetRetryMaxWaitTime(policy.MaxWaitTime).
+			SetRetryAfter(retryAfter).
+			AddRetryCondition(shouldRetry)
+	}
+}
+
+// WithRateLimit limits the requests per second to each klei host with token bucket,
+// the request will wait until a token is available or its context is done.
+func WithRateLimit(rps float64, burst int) Option {
+	return func(c *Client) {
+		if rps <= 0 {
+			return
+		}
+
+		if burst <= 0 {
+			burst = 1
+		}
+
+		limiter := &hostLimiter{limit: rate.Limit(rps), burst: burst, limiters: make(map[string]*rate.Limiter)}
+		// it will be executed before each attempt, so the retries are limited too
+		c.client.OnBeforeRequest(func(_ *resty.Client, request *resty.Request) error {
+			return limiter.Wait(request.Context(), request.URL)
+		})
+	}
+}
+
+// shouldRetry reports whether the request should be retried
+func shouldRetry(response *resty.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+
+	if response == nil {
+		return false
+	}
+
+	code := response.StatusCode()
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// retryAfter parses Retry-After header, returns 0 to use default backoff if absent
+func retryAfter(_ *resty.Client, response *resty.Response) (time.Duration, error) {
+	header := response.Header().Get("Retry-After")
+	if header == "" {
+		return 0, nil
+	}
+
+	// delay-seconds
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	// http-date
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// hostLimiter holds a token bucket for per host
+type hostLimiter struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.Mutex
+	limiters map[string]*rate.Limiter
+}
+
+// Wait blocks until the host of rawURL is allowed to send request
+func (h *hostLimiter) Wait(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	limiter, ok := h.limiters[u.Host]
+	if !ok {
+		limiter = rate.NewLimiter(h.limit, h.burst)
+		h.limiters[u.Host] = limiter
+	}
+	h.mu.Unlock()
+
+	if err := limiter.Wait(ctx); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// limiter fails fast if the wait time would exceed the context deadline
+		return errors.Join(context.DeadlineExceeded, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package lobbyapi_test
+
+import (
+	"context"
+	"errors"
+	"github.com/dstgo/tracker/pkg/lobbyapi"
+	"github.com/dstgo/tracker/pkg/lobbyapi/lobbytest"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryTransientFailure(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	path := "/ap-east-1-Steam.json.gz"
+	lobby.SetFailures(path, http.StatusBadGateway, 2, "")
+
+	policy := lobbyapi.RetryPolicy{Count: 3, WaitTime: time.Millisecond, MaxWaitTime: 10 * time.Millisecond}
+	client := lobbyapi.New("", append(lobby.Options(), lobbyapi.WithRetry(policy))...)
+
+	servers, err := client.GetLobbyServers("ap-east-1", lobbyapi.Steam.String())
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(servers.List) != 2 {
+		t.Errorf("expected 2 servers, got %d", len(servers.List))
+	}
+	if n := lobby.Requests(path); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	path := "/ap-east-1-Steam.json.gz"
+	lobby.SetFailures(path, http.StatusTooManyRequests, 10, "1")
+
+	policy := lobbyapi.RetryPolicy{Count: 2, WaitTime: time.Millisecond, MaxWaitTime: 10 * time.Millisecond}
+	client := lobbyapi.New("", append(lobby.Options(), lobbyapi.WithRetry(policy))...)
+
+	_, err := client.GetLobbyServers("ap-east-1", lobbyapi.Steam.String())
+	if !errors.Is(err, lobbyapi.ErrRateLimited) {
+		t.Errorf("expected ErrRateLimited, got %v", err)
+	}
+	if n := lobby.Requests(path); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestRetryNotFound(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	policy := lobbyapi.RetryPolicy{Count: 3, WaitTime: time.Millisecond, MaxWaitTime: 10 * time.Millisecond}
+	client := lobbyapi.New("", append(lobby.Options(), lobbyapi.WithRetry(policy))...)
+
+	_, err := client.GetLobbyServers("unknown", lobbyapi.Steam.String())
+	if !errors.Is(err, lobbyapi.ErrRegionNotFound) {
+		t.Errorf("expected ErrRegionNotFound, got %v", err)
+	}
+	if n := lobby.Requests("/unknown-Steam.json.gz"); n != 1 {
+		t.Errorf("4xx must not be retried, got %d requests", n)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobbyapi.New("", append(lobby.Options(), lobbyapi.WithRateLimit(20, 1))...)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := client.GetCapableRegions(); err != nil {
+			t.Error(err)
+			return
+		}
+	}
+
+	// 1 burst + 4 tokens at 20 rps
+	if cost := time.Since(start); cost < 150*time.Millisecond {
+		t.Errorf("requests are not limited, cost %s", cost)
+	}
+}
+
+func TestRateLimitCanceled(t *testing.T) {
+	lobby := lobbytest.NewServer()
+	defer lobby.Close()
+
+	client := lobbyapi.New("", append(lobby.Options(), lobbyapi.WithRateLimit(0.1, 1))...)
+	if _, err := client.GetCapableRegions(); err != nil {
+		t.Error(err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GetCapableRegionsWithContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+}
@@ -37,6 +37,35 @@ func (p Platform) String() string {
 	return "unknown platform"
 }
 
+// WeGame is the display name of Rail platform, see PlatformDisplayName
+const WeGame = "WeGame"
+
+// PlatformOption is the platform enum used to filter servers, it distinguishes WeGame from Rail
+type PlatformOption int
+
+const (
+	AllPlatforms PlatformOption = iota
+	SteamOption
+	WeGameOption
+	PSNOption
+	XboxOption
+	PS4OfficialOption
+	SwitchOption
+)
+
+// ServerType is the hosting type of server
+type ServerType int
+
+const (
+	AllServerTypes ServerType = iota
+	// Dedicated servers run on standalone server program
+	Dedicated
+	// ClientHosted servers are hosted by game client
+	ClientHosted
+	// SteamGroup servers belong to a steam group
+	SteamGroup
+)
+
 // Region represents dst lobby server region, it may be updated by klei in the future
 const (
 	UsEast1     = "us-east-1"
@@ -128,11 +157,62 @@ type Player struct {
 }
 
 type Mod struct {
-	Id       string `bson:"id" json:"id"`
-	Name     string `bson:"name" json:"name"`
-	Version1 string `bson:"version1" json:"version1"`
-	Version2 string `bson:"version2" json:"version2"`
-	Enabled  bool   `bson:"enabled" json:"enabled"`
+	// workshop id for workshop mods, folder name for local mods
+	Id   string `bson:"id" json:"id"`
+	Name string `bson:"name" json:"name"`
+	// version in modinfo.lua
+	Version string `bson:"version" json:"version"`
+	// version_compatible in modinfo.lua, the minimum version that clients are compatible with,
+	// it is the same as Version at most time
+	VersionCompatible string `bson:"version_compatible" json:"versionCompatible"`
+	Enabled           bool   `bson:"enabled" json:"enabled"`
+	// whether the mod is downloaded from steam workshop
+	Workshop bool `bson:"workshop" json:"workshop"`
+}
+
+// Seasons represents the length of each season, e.g. default, noseason, veryshortseason, longseason
+type Seasons struct {
+	Autumn string `bson:"autumn" json:"autumn"`
+	Winter string `bson:"winter" json:"winter"`
+	Spring string `bson:"spring" json:"spring"`
+	Summer string `bson:"summer" json:"summer"`
+}
+
+// ShardWorldGen is the world generation settings of single shard
+type ShardWorldGen struct {
+	// forest, cave
+	Location string `bson:"location" json:"location"`
+	// preset id, e.g. SURVIVAL_TOGETHER, DST_CAVE
+	Preset         string `bson:"preset" json:"preset"`
+	Name           string `bson:"name" json:"name"`
+	SettingsPreset string `bson:"settings_preset" json:"settingsPreset"`
+	WorldGenPreset string `bson:"world_gen_preset" json:"worldGenPreset"`
+	Version        int    `bson:"version" json:"version"`
+
+	// frequently used overrides
+	TaskSet       string  `bson:"task_set" json:"taskSet"`
+	WorldSize     string  `bson:"world_size" json:"worldSize"`
+	StartLocation string  `bson:"start_location" json:"startLocation"`
+	SeasonStart   string  `bson:"season_start" json:"seasonStart"`
+	Seasons       Seasons `bson:"seasons" json:"seasons"`
+
+	// all the overrides, e.g. carrots=often, rock=mostly, hounds=never
+	Overrides map[string]string `bson:"overrides" json:"overrides"`
+}
+
+// WorldGen is the world generation settings of all shards
+type WorldGen struct {
+	Shards []ShardWorldGen `bson:"shards" json:"shards"`
+}
+
+// Shard returns the first shard at the given location
+func (w WorldGen) Shard(location string) (ShardWorldGen, bool) {
+	for _, shard := range w.Shards {
+		if shard.Location == location {
+			return shard, true
+		}
+	}
+	return ShardWorldGen{}, false
 }
 
 type Details struct {
@@ -141,12 +221,15 @@ type Details struct {
 	DaysLeftInSeason   int      `bson:"days_left_in_season" json:"daysLeftInSeason"`
 	Players            []Player `bson:"players" json:"playerList"`
 	Mods               []Mod    `bson:"mods" json:"modList"`
+	// malformed entries in mods_info
+	ModsErrors []string `bson:"mods_errors,omitempty" json:"modsErrors,omitempty"`
+	WorldGen   WorldGen `bson:"world_gen" json:"worldGen"`
 }
 
 // ServerDetails includes some details information
 type ServerDetails struct {
 	// repeat options
-	Server
+	Server `bson:"inline"`
 
 	Tick          int  `json:"tick" bson:"tick"`
 	ClientModsOff bool `json:"clientmodsoff" bson:"client_mods_off"`
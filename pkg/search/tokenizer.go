@@ -0,0 +1,150 @@
+// Package search provides the tokenizer for full-text search of server names, tags and hosts.
+//
+// MongoDB text index does not segment CJK text, so the text is tokenized before stored and queried:
+// CJK runs are split into unigrams and bigrams, the other words are indexed with their prefixes
+// so that incomplete words could be matched too. The tokens only contain letters and digits,
+// it is safe to pass them to $text without escaping.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxQueryRunes limits the runes of query that will be tokenized
+	MaxQueryRunes = 64
+	// MaxPrefixRunes limits the length of word prefixes
+	MaxPrefixRunes = 16
+	// MaxTokens limits the tokens of single text
+	MaxTokens = 256
+)
+
+// IndexTokens returns the tokens to be stored in text index
+func IndexTokens(text string) []string {
+	var tokens []string
+	for _, run := range splitRuns(text) {
+		if run.cjk {
+			// unigrams
+			for _, r := range run.runes {
+				tokens = append(tokens, string(r))
+			}
+			tokens = append(tokens, bigrams(run.runes)...)
+		} else {
+			// prefixes of word, the first letter and the word itself included, so single letter query could match
+			for i := 1; i <= min(len(run.runes), MaxPrefixRunes); i++ {
+				tokens = append(tokens, string(run.runes[:i]))
+			}
+		}
+	}
+	return limit(dedup(tokens))
+}
+
+// QueryTokens returns the tokens to search, it returns nil if no searchable tokens in query
+func QueryTokens(query string) []string {
+	if runes := []rune(query); len(runes) > MaxQueryRunes {
+		query = string(runes[:MaxQueryRunes])
+	}
+
+	var tokens []string
+	for _, run := range splitRuns(query) {
+		if run.cjk && len(run.runes) > 1 {
+			tokens = append(tokens, bigrams(run.runes)...)
+		} else {
+			tokens = append(tokens, string(run.runes[:min(len(run.runes), MaxPrefixRunes)]))
+		}
+	}
+	return limit(dedup(tokens))
+}
+
+// Text joins the tokens into text which is stored in text index
+func Text(tokens []string) string {
+	return strings.Join(tokens, " ")
+}
+
+type textRun struct {
+	runes []rune
+	cjk   bool
+}
+
+// splitRuns normalizes text and splits it into runs of CJK characters and words, the other characters are separators
+func splitRuns(text string) []textRun {
+	var (
+		runs    []textRun
+		current textRun
+	)
+
+	flush := func() {
+		if len(current.runes) > 0 {
+			runs = append(runs, current)
+		}
+		current = textRun{}
+	}
+
+	for _, r := range text {
+		r = normalize(r)
+		switch {
+		case isCJK(r):
+			if !current.cjk {
+				flush()
+				current.cjk = true
+			}
+			current.runes = append(current.runes, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if current.cjk {
+				flush()
+			}
+			current.runes = append(current.runes, r)
+		default:
+			flush()
+		}
+	}
+	flush()
+
+	return runs
+}
+
+// Fold returns the text with full-width ascii and case folded, it is used to match names exactly or by prefix
+func Fold(text string) string {
+	return strings.Map(normalize, strings.TrimSpace(text))
+}
+
+// normalize folds full-width ascii and case
+func normalize(r rune) rune {
+	if r >= '！' && r <= '～' {
+		r -= '！' - '!'
+	}
+	return unicode.ToLower(r)
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+func bigrams(runes []rune) []string {
+	var tokens []string
+	for i := 0; i+1 < len(runes); i++ {
+		tokens = append(tokens, string(runes[i:i+2]))
+	}
+	return tokens
+}
+
+func dedup(tokens []string) []string {
+	seen := make(map[string]struct{}, len(tokens))
+	result := tokens[:0]
+	for _, token := range tokens {
+		if _, ok := seen[token]; ok {
+			continue
+		}
+		seen[token] = struct{}{}
+		result = append(result, token)
+	}
+	return result
+}
+
+func limit(tokens []string) []string {
+	if len(tokens) > MaxTokens {
+		return tokens[:MaxTokens]
+	}
+	return tokens
+}
@@ -0,0 +1,77 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIndexTokens(t *testing.T) {
+	samples := []struct {
+		text   string
+		tokens []string
+	}{
+		{"", nil},
+		{"Wilson", []string{"w", "wi", "wil", "wils", "wilso", "wilson"}},
+		{"饥荒联机", []string{"饥", "荒", "联", "机", "饥荒", "荒联", "联机"}},
+		{"萌新服 No.1", []string{"萌", "新", "服", "萌新", "新服", "n", "no", "1"}},
+		{"ＡＢ服", []string{"a", "ab", "服"}},
+	}
+
+	for _, sample := range samples {
+		tokens := IndexTokens(sample.text)
+		if len(tokens) == 0 && len(sample.tokens) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(tokens, sample.tokens) {
+			t.Errorf("IndexTokens(%q) = %v, expected %v", sample.text, tokens, sample.tokens)
+		}
+	}
+}
+
+func TestQueryTokens(t *testing.T) {
+	samples := []struct {
+		query  string
+		tokens []string
+	}{
+		{".*(a+)+$", []string{"a"}},
+		{"wils", []string{"wils"}},
+		{"联机 萌新", []string{"联机", "萌新"}},
+		{"服", []string{"服"}},
+		{`"ab" -cd`, []string{"ab", "cd"}},
+	}
+
+	for _, sample := range samples {
+		tokens := QueryTokens(sample.query)
+		if !reflect.DeepEqual(tokens, sample.tokens) {
+			t.Errorf("QueryTokens(%q) = %v, expected %v", sample.query, tokens, sample.tokens)
+		}
+	}
+}
+
+func TestQueryMatchesIndex(t *testing.T) {
+	index := make(map[string]bool)
+	for _, token := range IndexTokens("【萌新】饥荒联机 Wilson's World") {
+		index[token] = true
+	}
+
+	for _, query := range []string{"萌新", "联机", "wil", "w", "WORLD", "饥荒 联机"} {
+		for _, token := range QueryTokens(query) {
+			if !index[token] {
+				t.Errorf("token %q of query %q not found in index", token, query)
+			}
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	samples := map[string]string{
+		" Wilson ": "wilson",
+		"ＷＩＬＳＯＮ１":  "wilson1",
+		"威尔逊":      "威尔逊",
+	}
+	for text, expected := range samples {
+		if folded := Fold(text); folded != expected {
+			t.Errorf("Fold(%q) = %q, expected %q", text, folded, expected)
+		}
+	}
+}
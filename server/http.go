@@ -77,7 +77,14 @@ func recoveryHandler() app.HandlerFunc {
 func cacheHandler(httpConf conf.HttpConf) app.HandlerFunc {
 	store := persist.NewMemoryStore(httpConf.CacheTTL)
 	cacheH := cache.NewCacheByRequestURIWithIgnoreQueryOrder(store, httpConf.CacheTTL, cache.WithPrefixKey("tracker-cache-"))
-	return cacheH
+	// only cache GET requests, request body is not a part of cache key
+	return func(c context.Context, ctx *app.RequestContext) {
+		if string(ctx.Method()) != consts.MethodGet {
+			ctx.Next(c)
+			return
+		}
+		cacheH(c, ctx)
+	}
 }
 
 func limiterHandler() app.HandlerFunc {
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"fmt"
+	"github.com/dstgo/tracker/conf"
+	"github.com/go-resty/resty/v2"
+	"golang.org/x/net/http/httpproxy"
+	"net/http"
+	"net/url"
+)
+
+// ProxyDirect is used to disable proxy for specific client
+const ProxyDirect = "direct"
+
+// newProxyClient returns a new resty client which sends requests through the given proxy,
+// proxy override takes precedence over the default proxy, ProxyDirect means no proxy.
+func newProxyClient(proxyConf conf.ProxyConf, override string) (*resty.Client, error) {
+	client := resty.New()
+
+	proxyFunc, err := proxyFuncOf(proxyConf, override)
+	if err != nil {
+		return nil, err
+	}
+
+	if proxyFunc != nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.Proxy = func(request *http.Request) (*url.URL, error) {
+			return proxyFunc(request.URL)
+		}
+		client.SetTransport(transport)
+	}
+
+	return client, nil
+}
+
+// proxyFuncOf returns the proxy func that honors NO_PROXY style exclusions, returns nil if no proxy needed
+func proxyFuncOf(proxyConf conf.ProxyConf, override string) (func(*url.URL) (*url.URL, error), error) {
+	proxyURL := proxyConf.URL
+	if override != "" {
+		proxyURL = override
+	}
+
+	if proxyURL == "" || proxyURL == ProxyDirect {
+		return nil, nil
+	}
+
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy url %q: %w", proxyURL, err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+
+	cfg := httpproxy.Config{
+		HTTPProxy:  proxyURL,
+		HTTPSProxy: proxyURL,
+		NoProxy:    proxyConf.NoProxy,
+	}
+
+	return cfg.ProxyFunc(), nil
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/dstgo/tracker/conf"
+	"net/url"
+	"testing"
+)
+
+func TestProxyFunc(t *testing.T) {
+	proxyConf := conf.ProxyConf{
+		URL:     "socks5://127.0.0.1:1080",
+		Lobby:   "http://127.0.0.1:7890",
+		Steam:   ProxyDirect,
+		NoProxy: "10.0.0.0/8,.internal.example.com",
+	}
+
+	samples := []struct {
+		override string
+		target   string
+		proxy    string
+	}{
+		{"", "https://api.steampowered.com", "socks5://127.0.0.1:1080"},
+		{proxyConf.Lobby, "https://lobby-v2-cdn.klei.com/regioncapabilities-v2.json", "http://127.0.0.1:7890"},
+		{proxyConf.Lobby, "http://10.1.2.3/lobby/read", ""},
+		{"", "https://api.internal.example.com", ""},
+		{proxyConf.Steam, "https://api.steampowered.com", ""},
+	}
+
+	for _, sample := range samples {
+		proxyFunc, err := proxyFuncOf(proxyConf, sample.override)
+		assert.Nil(t, err)
+
+		if proxyFunc == nil {
+			assert.DeepEqual(t, "", sample.proxy)
+			continue
+		}
+
+		target, err := url.Parse(sample.target)
+		assert.Nil(t, err)
+
+		proxy, err := proxyFunc(target)
+		assert.Nil(t, err)
+		if sample.proxy == "" {
+			assert.Nil(t, proxy)
+		} else {
+			assert.DeepEqual(t, sample.proxy, proxy.String())
+		}
+	}
+}
+
+func TestProxyFuncInvalid(t *testing.T) {
+	_, err := proxyFuncOf(conf.ProxyConf{URL: "ftp://127.0.0.1:21"}, "")
+	assert.NotNil(t, err)
+}
@@ -86,8 +86,26 @@ func NewTracker(ctx context.Context, logger hlog.FullLogger, appConf *conf.AppCo
 	}
 
 	// dst api initial
-	lobbyClient := lobbyapi.New(appConf.Dst.KleiToken)
-	steamClient, err := steamapi.New(appConf.Dst.SteamKey)
+	lobbyResty, err := newProxyClient(appConf.Dst.Proxy, appConf.Dst.Proxy.Lobby)
+	if err != nil {
+		return nil, err
+	}
+	lobbyClient := lobbyapi.NewWith(appConf.Dst.KleiToken, lobbyResty,
+		lobbyapi.WithRegionURL(appConf.Dst.Endpoints.RegionURL),
+		lobbyapi.WithServersURL(appConf.Dst.Endpoints.ServersURL),
+		lobbyapi.WithDetailsURL(appConf.Dst.Endpoints.DetailsURL),
+		lobbyapi.WithRetry(lobbyapi.RetryPolicy{
+			Count:       appConf.Dst.Lobby.Retry.Count,
+			WaitTime:    appConf.Dst.Lobby.Retry.WaitTime,
+			MaxWaitTime: appConf.Dst.Lobby.Retry.MaxWaitTime,
+		}),
+		lobbyapi.WithRateLimit(appConf.Dst.Lobby.Limit.Rate, appConf.Dst.Lobby.Limit.Burst),
+	)
+	steamResty, err := newProxyClient(appConf.Dst.Proxy, appConf.Dst.Proxy.Steam)
+	if err != nil {
+		return nil, err
+	}
+	steamClient, err := steamapi.NewWith(steamapi.WithClientKey(appConf.Dst.SteamKey), steamapi.WithClientResty(steamResty))
 	if err != nil {
 		return nil, err
 	}
@@ -114,8 +132,10 @@ func NewTracker(ctx context.Context, logger hlog.FullLogger, appConf *conf.AppCo
 	}
 
 	// load cron jobs
-	cronJobs, err := jobs.LoadCronJobs(appConf.Dst, apis.Lobby.LobbyHandler)
+	jobCtx, cancelJobs := context.WithCancel(context.Background())
+	cronJobs, err := jobs.LoadCronJobs(jobCtx, appConf.Dst, apis.Lobby.LobbyHandler)
 	if err != nil {
+		cancelJobs()
 		return nil, err
 	}
 
@@ -138,7 +158,8 @@ func NewTracker(ctx context.Context, logger hlog.FullLogger, appConf *conf.AppCo
 		}
 		hlog.Info("geodb closed successfully")
 
-		// wait for all jobs were stopped
+		// abort running jobs and wait for all jobs were stopped
+		cancelJobs()
 		<-cronJobs.Stop().Done()
 		hlog.Info("cron jobs stopped successfully")
 	}